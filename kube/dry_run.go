@@ -0,0 +1,137 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"ksniff/pkg/service/sniffer/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrDryRun stops the setup before anything is created or executed on the cluster
+var ErrDryRun = errors.New("dry run, nothing was created")
+
+// DryRunKubernetesApiService prints the helper pods instead of creating them, along with their difference
+// from the privileged spec every helper pod had before the bridges declared their requirements.
+type DryRunKubernetesApiService struct {
+	service *KubernetesApiServiceImpl
+	out     io.Writer
+}
+
+func NewDryRunKubernetesApiService(clientset kubernetes.Interface, targetNamespace string, out io.Writer) KubernetesApiService {
+	return &DryRunKubernetesApiService{
+		service: &KubernetesApiServiceImpl{clientset: clientset, targetNamespace: targetNamespace},
+		out:     out,
+	}
+}
+
+func (d *DryRunKubernetesApiService) ExecuteCommand(ctx context.Context, podName string, containerName string, command []string, stdOut io.Writer) (int, error) {
+	log.Infof("dry run: skipping command: '%v' on pod: '%s'", command, podName)
+	return 0, ErrDryRun
+}
+
+func (d *DryRunKubernetesApiService) DeletePod(ctx context.Context, podName string) error {
+	return nil
+}
+
+func (d *DryRunKubernetesApiService) CreatePrivilegedPod(ctx context.Context, nodeName string, containerName string, image string, requirements runtime.HelperRequirements, timeout time.Duration, serviceaccount string, options PrivilegedPodOptions) (*corev1.Pod, error) {
+	isSupported, err := d.service.IsSupportedContainerRuntime(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isSupported {
+		return nil, errors.Errorf("Container runtime on node %s isn't supported. Supported container runtimes are: %v", nodeName, runtime.SupportedContainerRuntimes)
+	}
+
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = d.service.targetNamespace
+	}
+
+	pod, err := BuildPrivilegedPod(namespace, nodeName, containerName, image, requirements, serviceaccount, options)
+	if err != nil {
+		return nil, err
+	}
+
+	legacyPod, err := BuildPrivilegedPod(namespace, nodeName, containerName, image, legacyRequirementsOf(requirements), serviceaccount, options)
+	if err != nil {
+		return nil, err
+	}
+
+	podYaml, err := yaml.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	legacyPodYaml, err := yaml.Marshal(legacyPod)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(legacyPodYaml)),
+		B:        difflib.SplitLines(string(podYaml)),
+		FromFile: "privileged",
+		ToFile:   "least-privilege",
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if diff == "" {
+		diff = "no difference, the helper pod needs the privileged spec\n"
+	}
+
+	_, err = fmt.Fprintf(d.out, "# helper pod on node: '%s'\n%s---\n# difference from the privileged spec\n%s", nodeName, podYaml, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	level := d.service.podSecurityLevel(ctx, namespace)
+	if violations := PodSecurityViolations(level, pod); len(violations) > 0 {
+		_, err = fmt.Fprintf(d.out, "# namespace: '%s' enforces the '%s' pod security level, the helper pod violates: %s\n",
+			namespace, level, strings.Join(violations, ", "))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrDryRun
+}
+
+func (d *DryRunKubernetesApiService) UploadFile(ctx context.Context, localPath string, remotePath string, podName string, containerName string) error {
+	log.Infof("dry run: skipping upload of: '%s' to: '%s' on pod: '%s', "+
+		"a helper pod is only created when the container has no tool to receive it", localPath, remotePath, podName)
+	return ErrDryRun
+}
+
+func (d *DryRunKubernetesApiService) UploadFileViaHelperPod(ctx context.Context, localPath string, remotePath string, helperPodName string, helperContainerName string,
+	podName string, containerName string, containerId string) error {
+	return ErrDryRun
+}
+
+// legacyRequirementsOf returns the privileged requirements a helper pod had in place of the given ones
+func legacyRequirementsOf(requirements runtime.HelperRequirements) runtime.HelperRequirements {
+	socketPath := ""
+	for _, hostPath := range requirements.HostPaths {
+		if hostPath.Name == runtime.SocketMountName {
+			socketPath = hostPath.HostPath
+		}
+	}
+
+	legacy := runtime.LegacyHelperRequirements(socketPath)
+	legacy.HostNetwork = requirements.HostNetwork
+
+	return legacy
+}
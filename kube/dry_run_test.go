@@ -0,0 +1,81 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"ksniff/pkg/service/sniffer/runtime"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDryRunCreatePrivilegedPod(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "docker://19.3.1"))
+	out := &bytes.Buffer{}
+	service := NewDryRunKubernetesApiService(clientset, "namespace", out)
+	requirements := runtime.NewDockerBridge().HelperRequirements("/var/run/docker.sock")
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		requirements, time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.Equal(t, ErrDryRun, err)
+	assert.Nil(t, pod)
+	assert.Contains(t, out.String(), "nodeName: node")
+	assert.Contains(t, out.String(), "-      privileged: true")
+	assert.Contains(t, out.String(), "-  hostPID: true")
+	assert.Contains(t, out.String(), "/var/run/docker.sock")
+	pods, _ := clientset.CoreV1().Pods("namespace").List(context.Background(), v1.ListOptions{})
+	assert.Empty(t, pods.Items)
+}
+
+func TestDryRunCreatePrivilegedPod_Legacy(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "docker://19.3.1"))
+	out := &bytes.Buffer{}
+	service := NewDryRunKubernetesApiService(clientset, "namespace", out)
+
+	// when
+	_, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.LegacyHelperRequirements("/var/run/docker.sock"), time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.Equal(t, ErrDryRun, err)
+	assert.Contains(t, out.String(), "no difference")
+}
+
+func TestDryRunCreatePrivilegedPod_UnsupportedRuntime(t *testing.T) {
+	// given
+	service := NewDryRunKubernetesApiService(newFakeClientset(true, newNode("node", "rkt://1.0")), "namespace", &bytes.Buffer{})
+
+	// when
+	_, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.HelperRequirements{}, time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrDryRun, err)
+}
+
+func TestLegacyRequirementsOf(t *testing.T) {
+	// given
+	requirements := runtime.HelperRequirements{
+		HostNetwork:  true,
+		Capabilities: []corev1.Capability{"NET_RAW"},
+		HostPaths:    []runtime.HostPathMount{runtime.SocketMount("/run/crio/crio.sock")},
+	}
+
+	// when
+	legacy := legacyRequirementsOf(requirements)
+
+	// then
+	expected := runtime.LegacyHelperRequirements("/run/crio/crio.sock")
+	expected.HostNetwork = true
+	assert.Equal(t, expected, legacy)
+}
@@ -0,0 +1,43 @@
+// Package fakeexec replaces the exec streams of the API server in tests.
+package fakeexec
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"ksniff/kube"
+)
+
+// Executor records the executed commands and answers them using Handler, exit code 0 when unset
+type Executor struct {
+	Handler func(req kube.ExecCommandRequest) (int, error)
+
+	mutex    sync.Mutex
+	commands [][]string
+}
+
+func (e *Executor) Execute(ctx context.Context, req kube.ExecCommandRequest) (int, error) {
+	e.mutex.Lock()
+	e.commands = append(e.commands, req.Command)
+	e.mutex.Unlock()
+
+	if e.Handler == nil {
+		return 0, nil
+	}
+
+	return e.Handler(req)
+}
+
+// Commands returns the executed commands, each joined by spaces
+func (e *Executor) Commands() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	commands := make([]string, 0, len(e.commands))
+	for _, command := range e.commands {
+		commands = append(commands, strings.Join(command, " "))
+	}
+
+	return commands
+}
@@ -0,0 +1,471 @@
+package fakeexec
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const websocketProtocolV5 = "v5.channel.k8s.io"
+
+// Every websocket message starts with the byte of the stream it belongs to
+const (
+	streamStdIn  byte = 0
+	streamStdOut byte = 1
+	streamStdErr byte = 2
+	streamError  byte = 3
+	streamClose  byte = 255
+)
+
+// Command is a command executed in the fake container
+type Command struct {
+	Args   []string
+	StdIn  io.Reader
+	StdOut io.Writer
+	StdErr io.Writer
+}
+
+// Handler runs a command and returns its exit code
+type Handler func(cmd *Command) int
+
+// Server answers pod exec requests over the websocket streaming protocol, running the commands
+// against a local sandbox directory which stands in for the filesystem of every container.
+// It knows the few commands ksniff relies on, anything else exits with 127 unless handled.
+type Server struct {
+	*httptest.Server
+
+	// Root of the container filesystem
+	Dir string
+
+	mutex    sync.Mutex
+	handlers map[string]Handler
+	commands [][]string
+}
+
+func NewServer(dir string) *Server {
+	s := &Server{Dir: dir, handlers: map[string]Handler{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveExec))
+
+	return s
+}
+
+// Handle runs the given handler for commands with the given name, taking precedence over the built in commands
+func (s *Server) Handle(name string, handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[name] = handler
+}
+
+// ServeCapture makes the executable at the given container path write the pcap to its output,
+// as tcpdump would. The command isn't found until the executable was uploaded.
+func (s *Server) ServeCapture(executablePath string, pcap []byte) {
+	s.Handle(executablePath, func(cmd *Command) int {
+		if _, err := os.Stat(s.Path(executablePath)); err != nil {
+			_, _ = fmt.Fprintf(cmd.StdErr, "%s: not found\n", executablePath)
+			return 127
+		}
+
+		if _, err := cmd.StdOut.Write(pcap); err != nil {
+			return 1
+		}
+
+		return 0
+	})
+}
+
+// Path returns the sandbox path of the given container path
+func (s *Server) Path(containerPath string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+containerPath)))
+}
+
+func (s *Server) RestConfig() *rest.Config {
+	return &rest.Config{Host: s.URL}
+}
+
+// Clientset sends the exec requests of the given clientset, usually a fake one, to the server
+func (s *Server) Clientset(clientset kubernetes.Interface) kubernetes.Interface {
+	return &clientsetWithExec{
+		Interface: clientset,
+		coreV1: &coreV1WithExec{
+			CoreV1Interface: clientset.CoreV1(),
+			restClient:      corev1client.NewForConfigOrDie(s.RestConfig()).RESTClient(),
+		},
+	}
+}
+
+// Commands returns the executed commands, each joined by spaces
+func (s *Server) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	commands := make([]string, 0, len(s.commands))
+	for _, command := range s.commands {
+		commands = append(commands, strings.Join(command, " "))
+	}
+
+	return commands
+}
+
+type clientsetWithExec struct {
+	kubernetes.Interface
+	coreV1 corev1client.CoreV1Interface
+}
+
+func (c *clientsetWithExec) CoreV1() corev1client.CoreV1Interface {
+	return c.coreV1
+}
+
+type coreV1WithExec struct {
+	corev1client.CoreV1Interface
+	restClient rest.Interface
+}
+
+func (c *coreV1WithExec) RESTClient() rest.Interface {
+	return c.restClient
+}
+
+func (s *Server) serveExec(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "only websocket exec is supported", http.StatusBadRequest)
+		return
+	}
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{websocketProtocolV5}}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	query := r.URL.Query()
+	args := query["command"]
+
+	s.mutex.Lock()
+	s.commands = append(s.commands, args)
+	s.mutex.Unlock()
+
+	var writeMutex sync.Mutex
+
+	stdIn, stdInWriter := io.Pipe()
+	defer stdIn.Close()
+
+	go readStdIn(conn, stdInWriter)
+
+	cmd := &Command{
+		Args:   args,
+		StdIn:  stdIn,
+		StdOut: &streamWriter{conn: conn, mutex: &writeMutex, stream: streamStdOut},
+		StdErr: &streamWriter{conn: conn, mutex: &writeMutex, stream: streamStdErr},
+	}
+
+	if query.Get("stdin") != "true" {
+		cmd.StdIn = strings.NewReader("")
+	}
+
+	exitCode := s.run(cmd)
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	_ = conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamError}, exitStatus(exitCode)...))
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// readStdIn forwards the stdin stream until the client closes it
+func readStdIn(conn *websocket.Conn, stdIn *io.PipeWriter) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			_ = stdIn.CloseWithError(err)
+			return
+		}
+
+		if len(message) == 2 && message[0] == streamClose && message[1] == streamStdIn {
+			_ = stdIn.Close()
+			continue
+		}
+
+		if len(message) > 1 && message[0] == streamStdIn {
+			// Fails once the command stopped reading, the rest is discarded
+			_, _ = stdIn.Write(message[1:])
+		}
+	}
+}
+
+// exitStatus returns the status the API server sends once the command exited
+func exitStatus(exitCode int) []byte {
+	status := metav1.Status{Status: metav1.StatusSuccess}
+
+	if exitCode != 0 {
+		status = metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("command terminated with non-zero exit code: exit status %d", exitCode),
+			Reason:  "NonZeroExitCode",
+			Details: &metav1.StatusDetails{
+				Causes: []metav1.StatusCause{{Type: "ExitCode", Message: strconv.Itoa(exitCode)}},
+			},
+		}
+	}
+
+	message, _ := json.Marshal(status)
+
+	return message
+}
+
+type streamWriter struct {
+	conn   *websocket.Conn
+	mutex  *sync.Mutex
+	stream byte
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, append([]byte{w.stream}, p...)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *Server) handler(name string) Handler {
+	s.mutex.Lock()
+	handler, ok := s.handlers[name]
+	s.mutex.Unlock()
+
+	if ok {
+		return handler
+	}
+
+	switch name {
+	case "sh", "/bin/sh":
+		return s.shell
+	case "command":
+		return s.command
+	case "true":
+		return func(cmd *Command) int { return 0 }
+	case "test":
+		return s.test
+	case "tar":
+		return s.tar
+	case "chmod":
+		return s.chmod
+	case "sha256sum":
+		return s.checksum(sha256.New)
+	case "md5sum":
+		return s.checksum(md5.New)
+	case "wc":
+		return s.wc
+	}
+
+	return nil
+}
+
+func (s *Server) run(cmd *Command) int {
+	if len(cmd.Args) == 0 {
+		_, _ = fmt.Fprintln(cmd.StdErr, "no command given")
+		return 126
+	}
+
+	handler := s.handler(cmd.Args[0])
+	if handler == nil {
+		_, _ = fmt.Fprintf(cmd.StdErr, "%s: not found\n", cmd.Args[0])
+		return 127
+	}
+
+	return handler(cmd)
+}
+
+// shell runs scripts made of a single simple command, without quoting, pipes or redirections
+func (s *Server) shell(cmd *Command) int {
+	if len(cmd.Args) != 3 || cmd.Args[1] != "-c" {
+		_, _ = fmt.Fprintf(cmd.StdErr, "unsupported shell invocation: '%v'\n", cmd.Args)
+		return 2
+	}
+
+	if strings.ContainsAny(cmd.Args[2], "|&;<>'\"$`") {
+		_, _ = fmt.Fprintf(cmd.StdErr, "unsupported shell script: '%s'\n", cmd.Args[2])
+		return 2
+	}
+
+	return s.run(&Command{Args: strings.Fields(cmd.Args[2]), StdIn: cmd.StdIn, StdOut: cmd.StdOut, StdErr: cmd.StdErr})
+}
+
+func (s *Server) command(cmd *Command) int {
+	if len(cmd.Args) != 3 || cmd.Args[1] != "-v" {
+		return 2
+	}
+
+	if s.handler(cmd.Args[2]) == nil {
+		return 1
+	}
+
+	_, _ = fmt.Fprintln(cmd.StdOut, cmd.Args[2])
+
+	return 0
+}
+
+func (s *Server) test(cmd *Command) int {
+	if len(cmd.Args) != 3 || cmd.Args[1] != "-f" {
+		return 2
+	}
+
+	fileInfo, err := os.Stat(s.Path(cmd.Args[2]))
+	if err != nil || !fileInfo.Mode().IsRegular() {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *Server) chmod(cmd *Command) int {
+	if len(cmd.Args) != 3 || cmd.Args[1] != "+x" {
+		return 1
+	}
+
+	if err := os.Chmod(s.Path(cmd.Args[2]), 0755); err != nil {
+		_, _ = fmt.Fprintf(cmd.StdErr, "chmod: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func (s *Server) checksum(newHash func() hash.Hash) Handler {
+	return func(cmd *Command) int {
+		if len(cmd.Args) != 2 {
+			return 1
+		}
+
+		file, err := os.Open(s.Path(cmd.Args[1]))
+		if err != nil {
+			_, _ = fmt.Fprintf(cmd.StdErr, "%s: %v\n", cmd.Args[0], err)
+			return 1
+		}
+		defer file.Close()
+
+		h := newHash()
+		if _, err := io.Copy(h, file); err != nil {
+			return 1
+		}
+
+		_, _ = fmt.Fprintf(cmd.StdOut, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), cmd.Args[1])
+
+		return 0
+	}
+}
+
+// wc supports counting the bytes of a file, e.g. wc -c /tmp/static-tcpdump
+func (s *Server) wc(cmd *Command) int {
+	if len(cmd.Args) != 3 || cmd.Args[1] != "-c" {
+		return 1
+	}
+
+	fileInfo, err := os.Stat(s.Path(cmd.Args[2]))
+	if err != nil {
+		_, _ = fmt.Fprintf(cmd.StdErr, "wc: %v\n", err)
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(cmd.StdOut, "%d %s\n", fileInfo.Size(), cmd.Args[2])
+
+	return 0
+}
+
+// tar supports listing and extracting an archive read from stdin, e.g. tar -xzf - -C /tmp
+func (s *Server) tar(cmd *Command) int {
+	if len(cmd.Args) == 2 && cmd.Args[1] == "--help" {
+		_, _ = fmt.Fprintln(cmd.StdOut, "Usage: tar [OPTION...] [FILE]...")
+		return 0
+	}
+
+	if len(cmd.Args) < 3 || cmd.Args[2] != "-" {
+		_, _ = fmt.Fprintf(cmd.StdErr, "tar: unsupported arguments: '%v'\n", cmd.Args[1:])
+		return 2
+	}
+
+	mode := cmd.Args[1]
+	dir := "/"
+	if len(cmd.Args) == 5 && cmd.Args[3] == "-C" {
+		dir = cmd.Args[4]
+	}
+
+	if fileInfo, err := os.Stat(s.Path(dir)); err != nil || !fileInfo.IsDir() {
+		_, _ = fmt.Fprintf(cmd.StdErr, "tar: %s: Cannot open: No such file or directory\n", dir)
+		return 2
+	}
+
+	var archive io.Reader = cmd.StdIn
+	if strings.Contains(mode, "z") {
+		gzipReader, err := gzip.NewReader(archive)
+		if err != nil {
+			_, _ = fmt.Fprintf(cmd.StdErr, "tar: %v\n", err)
+			return 2
+		}
+		archive = gzipReader
+	}
+
+	tarReader := tar.NewReader(archive)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(cmd.StdErr, "tar: %v\n", err)
+			return 2
+		}
+
+		if strings.HasPrefix(mode, "-t") {
+			_, _ = fmt.Fprintln(cmd.StdOut, header.Name)
+			continue
+		}
+
+		if err := s.extract(path.Join(dir, header.Name), header, tarReader); err != nil {
+			_, _ = fmt.Fprintf(cmd.StdErr, "tar: %v\n", err)
+			return 2
+		}
+	}
+}
+
+func (s *Server) extract(containerPath string, header *tar.Header, content io.Reader) error {
+	file, err := os.OpenFile(s.Path(containerPath), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, content); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Chmod(s.Path(containerPath), os.FileMode(header.Mode))
+}
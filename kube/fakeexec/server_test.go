@@ -0,0 +1,161 @@
+package fakeexec
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ksniff/kube"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newSandbox(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "ksniff-fakeexec")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "tmp"), 0755))
+
+	server := NewServer(dir)
+
+	return server, func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func newKubeRequest(server *Server) kube.KubeRequest {
+	return kube.KubeRequest{
+		Clientset:     server.Clientset(fake.NewSimpleClientset()),
+		RestConfig:    server.RestConfig(),
+		Namespace:     "default",
+		Pod:           "pod",
+		Container:     "container",
+		ExecTransport: kube.ExecTransportWebsocket,
+	}
+}
+
+func execute(t *testing.T, server *Server, command ...string) (int, string) {
+	stdOut := new(kube.Writer)
+
+	exitCode, err := kube.PodExecuteCommand(context.Background(), kube.ExecCommandRequest{
+		KubeRequest: newKubeRequest(server),
+		Command:     command,
+		StdOut:      stdOut,
+		StdErr:      &kube.NopWriter{},
+	})
+	assert.Nil(t, err)
+
+	return exitCode, stdOut.Output
+}
+
+func TestServer_UploadFile(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		// given
+		server, cleanup := newSandbox(t)
+		localFile := filepath.Join(server.Dir, "local")
+		assert.Nil(t, ioutil.WriteFile(localFile, []byte("static tcpdump"), 0644))
+
+		// when
+		exitCode, err := kube.PodUploadFile(context.Background(), kube.UploadFileRequest{
+			KubeRequest: newKubeRequest(server),
+			Src:         localFile,
+			Dst:         "/tmp/static-tcpdump",
+			Compress:    compress,
+		})
+
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, 0, exitCode)
+		content, err := ioutil.ReadFile(server.Path("/tmp/static-tcpdump"))
+		assert.Nil(t, err)
+		assert.Equal(t, "static tcpdump", string(content))
+		fileInfo, _ := os.Stat(server.Path("/tmp/static-tcpdump"))
+		assert.Equal(t, os.FileMode(0755), fileInfo.Mode().Perm())
+
+		cleanup()
+	}
+}
+
+func TestServer_UploadFileFailureWithProgress(t *testing.T) {
+	// given
+	server, cleanup := newSandbox(t)
+	defer cleanup()
+	server.Handle("tar", func(cmd *Command) int {
+		return 2
+	})
+	localFile := filepath.Join(server.Dir, "local")
+	assert.Nil(t, ioutil.WriteFile(localFile, bytes.Repeat([]byte("static tcpdump"), 100000), 0644))
+	progress := &bytes.Buffer{}
+
+	// when
+	exitCode, _ := kube.PodUploadFile(context.Background(), kube.UploadFileRequest{
+		KubeRequest: newKubeRequest(server),
+		Src:         localFile,
+		Dst:         "/tmp/static-tcpdump",
+		Progress:    progress,
+	})
+
+	// then
+	assert.Equal(t, 2, exitCode)
+	assert.Contains(t, progress.String(), "static-tcpdump", "the progress is done once the tar writer stopped")
+}
+
+func TestServer_BuiltInCommands(t *testing.T) {
+	// given
+	server, cleanup := newSandbox(t)
+	defer cleanup()
+	assert.Nil(t, ioutil.WriteFile(server.Path("/tmp/file"), []byte("ksniff"), 0644))
+
+	// when
+	fileExitCode, _ := execute(t, server, "/bin/sh", "-c", "test -f /tmp/file")
+	missingExitCode, _ := execute(t, server, "/bin/sh", "-c", "test -f /tmp/missing")
+	checksumExitCode, checksum := execute(t, server, "sha256sum", "/tmp/file")
+	notFoundExitCode, _ := execute(t, server, "tcpdump", "--version")
+	commandExitCode, _ := execute(t, server, "/bin/sh", "-c", "command -v gzip")
+
+	// then
+	assert.Equal(t, 0, fileExitCode)
+	assert.Equal(t, 1, missingExitCode)
+	assert.Equal(t, 0, checksumExitCode)
+	assert.Equal(t, "05f6011df9fc928707d2ae7c7d6d2ddd5100195fd0baa90af9b00f4ec1935acc  /tmp/file\n", checksum)
+	assert.Equal(t, 127, notFoundExitCode)
+	assert.Equal(t, 1, commandExitCode)
+	assert.Equal(t, []string{"/bin/sh -c test -f /tmp/file", "/bin/sh -c test -f /tmp/missing",
+		"sha256sum /tmp/file", "tcpdump --version", "/bin/sh -c command -v gzip"}, server.Commands())
+}
+
+func TestServer_ServeCapture(t *testing.T) {
+	// given
+	server, cleanup := newSandbox(t)
+	defer cleanup()
+	server.ServeCapture("/tmp/static-tcpdump", []byte("pcap"))
+
+	// when
+	beforeUploadExitCode, _ := execute(t, server, "/tmp/static-tcpdump", "-i", "any", "-U", "-w", "-")
+	assert.Nil(t, ioutil.WriteFile(server.Path("/tmp/static-tcpdump"), []byte("static tcpdump"), 0755))
+	exitCode, output := execute(t, server, "/tmp/static-tcpdump", "-i", "any", "-U", "-w", "-")
+
+	// then
+	assert.Equal(t, 127, beforeUploadExitCode)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "pcap", output)
+}
+
+func TestServer_Handle(t *testing.T) {
+	// given
+	server, cleanup := newSandbox(t)
+	defer cleanup()
+	server.Handle("tar", func(cmd *Command) int {
+		return 127
+	})
+
+	// when
+	exitCode, _ := execute(t, server, "tar", "--help")
+
+	// then
+	assert.Equal(t, 127, exitCode)
+}
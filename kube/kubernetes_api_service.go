@@ -5,10 +5,9 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
-	"k8s.io/apimachinery/pkg/api/resource"
-
 	"ksniff/pkg/service/sniffer/runtime"
 	"ksniff/utils"
 
@@ -21,31 +20,83 @@ import (
 )
 
 type KubernetesApiService interface {
-	ExecuteCommand(podName string, containerName string, command []string, stdOut io.Writer) (int, error)
+	ExecuteCommand(ctx context.Context, podName string, containerName string, command []string, stdOut io.Writer) (int, error)
+
+	DeletePod(ctx context.Context, podName string) error
 
-	DeletePod(podName string) error
+	// The pod is returned along with the error when it was created but didn't start,
+	// so it can still be deleted
+	CreatePrivilegedPod(ctx context.Context, nodeName string, containerName string, image string, requirements runtime.HelperRequirements, timeout time.Duration, serviceaccount string, options PrivilegedPodOptions) (*corev1.Pod, error)
 
-	CreatePrivilegedPod(nodeName string, containerName string, image string, socketPath string, timeout time.Duration, serviceaccount string) (*corev1.Pod, error)
+	UploadFile(ctx context.Context, localPath string, remotePath string, podName string, containerName string) error
 
-	UploadFile(localPath string, remotePath string, podName string, containerName string) error
+	// Upload a file into a container through the root filesystem of its process,
+	// using a privileged pod sharing the host PID namespace
+	UploadFileViaHelperPod(ctx context.Context, localPath string, remotePath string, helperPodName string, helperContainerName string,
+		podName string, containerName string, containerId string) error
 }
 
 type KubernetesApiServiceImpl struct {
-	clientset       *kubernetes.Clientset
+	clientset       kubernetes.Interface
 	restConfig      *rest.Config
 	targetNamespace string
+	execTransport   string
+	executor        CommandExecutor
+	// Receives the progress bar of uploads when set
+	uploadProgress io.Writer
+
+	// Namespaces of the pods created by the service, which may differ from the target namespace
+	helperPodsMutex sync.Mutex
+	helperPods      map[string]string
+}
+
+func NewKubernetesApiService(clientset kubernetes.Interface,
+	restConfig *rest.Config, targetNamespace string, execTransport string, uploadProgress io.Writer) KubernetesApiService {
+
+	return &KubernetesApiServiceImpl{clientset: clientset,
+		restConfig:      restConfig,
+		targetNamespace: targetNamespace,
+		execTransport:   execTransport,
+		uploadProgress:  uploadProgress}
 }
 
-func NewKubernetesApiService(clientset *kubernetes.Clientset,
-	restConfig *rest.Config, targetNamespace string) KubernetesApiService {
+// NewKubernetesApiServiceWithExecutor runs every command in containers through the given executor
+func NewKubernetesApiServiceWithExecutor(clientset kubernetes.Interface,
+	restConfig *rest.Config, targetNamespace string, executor CommandExecutor, uploadProgress io.Writer) KubernetesApiService {
 
 	return &KubernetesApiServiceImpl{clientset: clientset,
 		restConfig:      restConfig,
-		targetNamespace: targetNamespace}
+		targetNamespace: targetNamespace,
+		executor:        executor,
+		uploadProgress:  uploadProgress}
+}
+
+// namespaceOf returns the namespace of the given pod, the target namespace unless the service created it
+func (k *KubernetesApiServiceImpl) namespaceOf(podName string) string {
+	k.helperPodsMutex.Lock()
+	defer k.helperPodsMutex.Unlock()
+
+	if namespace, ok := k.helperPods[podName]; ok {
+		return namespace
+	}
+
+	return k.targetNamespace
+}
+
+func (k *KubernetesApiServiceImpl) kubeRequest(podName string, containerName string) KubeRequest {
+	return KubeRequest{
+		Clientset:     k.clientset,
+		RestConfig:    k.restConfig,
+		Namespace:     k.namespaceOf(podName),
+		Pod:           podName,
+		Container:     containerName,
+		ExecTransport: k.execTransport,
+		Executor:      k.executor,
+	}
 }
 
-func (k *KubernetesApiServiceImpl) IsSupportedContainerRuntime(nodeName string) (bool, error) {
-	node, err := k.clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, v1.GetOptions{})
+func (k *KubernetesApiServiceImpl) IsSupportedContainerRuntime(ctx context.Context, nodeName string) (bool, error) {
+	node, err := k.clientset.CoreV1().Nodes().Get(ctx, nodeName, v1.GetOptions{})
 	if err != nil {
 		return false, err
 	}
@@ -61,25 +112,19 @@ func (k *KubernetesApiServiceImpl) IsSupportedContainerRuntime(nodeName string)
 	return false, nil
 }
 
-func (k *KubernetesApiServiceImpl) ExecuteCommand(podName string, containerName string, command []string, stdOut io.Writer) (int, error) {
+func (k *KubernetesApiServiceImpl) ExecuteCommand(ctx context.Context, podName string, containerName string, command []string, stdOut io.Writer) (int, error) {
 
-	log.Infof("executing command: '%s' on container: '%s', pod: '%s', namespace: '%s'", command, containerName, podName, k.targetNamespace)
+	log.Infof("executing command: '%s' on container: '%s', pod: '%s', namespace: '%s'", command, containerName, podName, k.namespaceOf(podName))
 	stdErr := new(Writer)
 
 	executeTcpdumpRequest := ExecCommandRequest{
-		KubeRequest: KubeRequest{
-			Clientset:  k.clientset,
-			RestConfig: k.restConfig,
-			Namespace:  k.targetNamespace,
-			Pod:        podName,
-			Container:  containerName,
-		},
-		Command: command,
-		StdErr:  stdErr,
-		StdOut:  stdOut,
-	}
-
-	exitCode, err := PodExecuteCommand(executeTcpdumpRequest)
+		KubeRequest: k.kubeRequest(podName, containerName),
+		Command:     command,
+		StdErr:      stdErr,
+		StdOut:      stdOut,
+	}
+
+	exitCode, err := PodExecuteCommand(ctx, executeTcpdumpRequest)
 	if err != nil {
 		log.WithError(err).Errorf("failed executing command: '%s', exitCode: '%d', stdErr: '%s'",
 			command, exitCode, stdErr.Output)
@@ -92,20 +137,27 @@ func (k *KubernetesApiServiceImpl) ExecuteCommand(podName string, containerName
 	return exitCode, err
 }
 
-func (k *KubernetesApiServiceImpl) DeletePod(podName string) error {
+func (k *KubernetesApiServiceImpl) DeletePod(ctx context.Context, podName string) error {
 	var gracePeriodTime int64 = 0
 
-	err := k.clientset.CoreV1().Pods(k.targetNamespace).Delete(context.TODO(), podName, v1.DeleteOptions{
+	err := k.clientset.CoreV1().Pods(k.namespaceOf(podName)).Delete(ctx, podName, v1.DeleteOptions{
 		GracePeriodSeconds: &gracePeriodTime,
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	k.helperPodsMutex.Lock()
+	delete(k.helperPods, podName)
+	k.helperPodsMutex.Unlock()
+
+	return nil
 }
 
-func (k *KubernetesApiServiceImpl) CreatePrivilegedPod(nodeName string, containerName string, image string, socketPath string, timeout time.Duration, serviceaccount string) (*corev1.Pod, error) {
+func (k *KubernetesApiServiceImpl) CreatePrivilegedPod(ctx context.Context, nodeName string, containerName string, image string, requirements runtime.HelperRequirements, timeout time.Duration, serviceaccount string, options PrivilegedPodOptions) (*corev1.Pod, error) {
 	log.Debugf("creating privileged pod on remote node")
 
-	isSupported, err := k.IsSupportedContainerRuntime(nodeName)
+	isSupported, err := k.IsSupportedContainerRuntime(ctx, nodeName)
 	if err != nil {
 		return nil, err
 	}
@@ -114,106 +166,37 @@ func (k *KubernetesApiServiceImpl) CreatePrivilegedPod(nodeName string, containe
 		return nil, errors.Errorf("Container runtime on node %s isn't supported. Supported container runtimes are: %v", nodeName, runtime.SupportedContainerRuntimes)
 	}
 
-	typeMetadata := v1.TypeMeta{
-		Kind:       "Pod",
-		APIVersion: "v1",
-	}
-
-	// https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
-	objectMetadata := v1.ObjectMeta{
-		GenerateName: "ksniff-",
-		Namespace:    k.targetNamespace,
-		Labels: map[string]string{
-			"app":                    "ksniff",
-			"app.kubernetes.io/name": "ksniff",
-		},
-	}
-
-	volumeMounts := []corev1.VolumeMount{
-		{
-			Name:      "container-socket",
-			ReadOnly:  true,
-			MountPath: socketPath,
-		},
-		{
-			Name:      "host",
-			ReadOnly:  false,
-			MountPath: "/host",
-		},
-	}
-
-	privileged := true
-	privilegedContainer := corev1.Container{
-		Name:            containerName,
-		Image:           image,
-		ImagePullPolicy: "IfNotPresent",
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: &privileged,
-		},
-		Command:      []string{"sh", "-c", "sleep 10000000"},
-		VolumeMounts: volumeMounts,
-		Resources: corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("0.1"),
-				corev1.ResourceMemory: resource.MustParse("128Mi"),
-			},
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("1"),
-				corev1.ResourceMemory: resource.MustParse("256Mi"),
-			},
-		},
-	}
-
-	hostPathType := corev1.HostPathSocket
-	directoryType := corev1.HostPathDirectory
-
-	podSpecs := corev1.PodSpec{
-		NodeName:      nodeName,
-		RestartPolicy: corev1.RestartPolicyNever,
-		HostPID:       true,
-		Containers:    []corev1.Container{privilegedContainer},
-		Volumes: []corev1.Volume{
-			{
-				Name: "host",
-				VolumeSource: corev1.VolumeSource{
-					HostPath: &corev1.HostPathVolumeSource{
-						Path: "/",
-						Type: &directoryType,
-					},
-				},
-			},
-			{
-				Name: "container-socket",
-				VolumeSource: corev1.VolumeSource{
-					HostPath: &corev1.HostPathVolumeSource{
-						Path: socketPath,
-						Type: &hostPathType,
-					},
-				},
-			},
-		},
-	}
-
-	if serviceaccount != "" {
-		podSpecs.ServiceAccountName = serviceaccount
-	}
-
-	pod := corev1.Pod{
-		TypeMeta:   typeMetadata,
-		ObjectMeta: objectMetadata,
-		Spec:       podSpecs,
-	}
-
-	createdPod, err := k.clientset.CoreV1().Pods(k.targetNamespace).Create(context.TODO(), &pod, v1.CreateOptions{})
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = k.targetNamespace
+	}
+
+	pod, err := BuildPrivilegedPod(namespace, nodeName, containerName, image, requirements, serviceaccount, options)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := k.checkPodSecurity(ctx, namespace, pod); err != nil {
+		return nil, err
+	}
+
+	createdPod, err := k.clientset.CoreV1().Pods(namespace).Create(ctx, pod, v1.CreateOptions{})
+	if err != nil {
+		return nil, k.podSecurityRejection(ctx, namespace, pod, err)
+	}
+
+	k.helperPodsMutex.Lock()
+	if k.helperPods == nil {
+		k.helperPods = map[string]string{}
+	}
+	k.helperPods[createdPod.Name] = createdPod.Namespace
+	k.helperPodsMutex.Unlock()
+
 	log.Infof("pod: '%v' created successfully in namespace: '%v'", createdPod.ObjectMeta.Name, createdPod.ObjectMeta.Namespace)
 	log.Debugf("created pod details: %v", createdPod)
 
 	verifyPodState := func() bool {
-		podStatus, err := k.clientset.CoreV1().Pods(k.targetNamespace).Get(context.TODO(), createdPod.Name, v1.GetOptions{})
+		podStatus, err := k.clientset.CoreV1().Pods(namespace).Get(ctx, createdPod.Name, v1.GetOptions{})
 		if err != nil {
 			return false
 		}
@@ -227,21 +210,40 @@ func (k *KubernetesApiServiceImpl) CreatePrivilegedPod(nodeName string, containe
 
 	log.Info("waiting for pod successful startup")
 
-	if !utils.RunWhileFalse(verifyPodState, timeout, 1*time.Second) {
-		return nil, errors.Errorf("failed to create pod within timeout (%s)", timeout)
+	if !utils.RunWhileFalseContext(ctx, verifyPodState, timeout, 1*time.Second) {
+		if ctx.Err() != nil {
+			return createdPod, ctx.Err()
+		}
+		return createdPod, errors.Errorf("failed to create pod within timeout (%s)", timeout)
 	}
 
 	return createdPod, nil
 }
 
-func (k *KubernetesApiServiceImpl) checkIfFileExistOnPod(remotePath string, podName string, containerName string) (bool, error) {
+func (k *KubernetesApiServiceImpl) checkIfFileExistOnPod(ctx context.Context, remotePath string, podName string, containerName string) (bool, error) {
 	stdOut := new(Writer)
 	stdErr := new(Writer)
 
+	req := k.kubeRequest(podName, containerName)
+
 	command := []string{"/bin/sh", "-c", fmt.Sprintf("test -f %s", remotePath)}
 
-	exitCode, err := k.ExecuteCommand(podName, containerName, command, stdOut)
+	if !probeCommand(ctx, req, []string{"/bin/sh", "-c", "true"}) {
+		// Without a shell, executing the file is the only way left to tell it exists
+		log.Debugf("no shell on container: '%s', checking file by executing it", containerName)
+		command = []string{remotePath, "--version"}
+	}
+
+	exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     command,
+		StdOut:      stdOut,
+		StdErr:      stdErr,
+	})
 	if err != nil {
+		if command[0] == remotePath {
+			return false, nil
+		}
 		return false, err
 	}
 
@@ -249,50 +251,82 @@ func (k *KubernetesApiServiceImpl) checkIfFileExistOnPod(remotePath string, podN
 		return false, nil
 	}
 
-	if stdErr.Output != "" {
-		return false, errors.New("failed to check for tcpdump")
-	}
-
-	log.Infof("file found: '%s'", stdOut.Output)
+	log.Infof("file found: '%s'", remotePath)
 
 	return true, nil
 }
 
-func (k *KubernetesApiServiceImpl) UploadFile(localPath string, remotePath string, podName string, containerName string) error {
+func (k *KubernetesApiServiceImpl) UploadFile(ctx context.Context, localPath string, remotePath string, podName string, containerName string) error {
 	log.Infof("uploading file: '%s' to '%s' on container: '%s'", localPath, remotePath, containerName)
 
-	isExist, err := k.checkIfFileExistOnPod(remotePath, podName, containerName)
+	req := UploadFileRequest{
+		KubeRequest: k.kubeRequest(podName, containerName),
+		Src:         localPath,
+		Dst:         remotePath,
+		Progress:    k.uploadProgress,
+	}
+
+	isExist, err := k.checkIfFileExistOnPod(ctx, remotePath, podName, containerName)
 	if err != nil {
 		return err
 	}
 
 	if isExist {
-		log.Info("file was already found on remote pod")
-		return nil
+		result, err := verifyRemoteChecksum(ctx, req.KubeRequest, localPath, remotePath)
+		if err != nil {
+			return err
+		}
+
+		switch result {
+		case checksumMatch:
+			log.Info("file was already found on remote pod, checksum matches")
+			return nil
+		case checksumUnverified:
+			log.Warnf("file found on: '%s' can't be verified without a checksum tool or wc, replacing it", remotePath)
+		default:
+			log.Warnf("file found on: '%s' doesn't match the local file, replacing it", remotePath)
+		}
+	} else {
+		log.Infof("file not found on: '%s', starting to upload", remotePath)
 	}
 
-	log.Infof("file not found on: '%s', starting to upload", remotePath)
+	if err = uploadUsingStrategies(ctx, req, DefaultUploadStrategies); err != nil {
+		return err
+	}
+
+	return k.verifyFileUploaded(ctx, req, localPath)
+}
+
+func (k *KubernetesApiServiceImpl) UploadFileViaHelperPod(ctx context.Context, localPath string, remotePath string, helperPodName string,
+	helperContainerName string, podName string, containerName string, containerId string) error {
+	log.Infof("uploading file: '%s' to '%s' on container: '%s' through pod: '%s'", localPath, remotePath, containerName, helperPodName)
 
 	req := UploadFileRequest{
-		KubeRequest: KubeRequest{
-			Clientset:  k.clientset,
-			RestConfig: k.restConfig,
-			Namespace:  k.targetNamespace,
-			Pod:        podName,
-			Container:  containerName,
-		},
-		Src: localPath,
-		Dst: remotePath,
+		KubeRequest: k.kubeRequest(helperPodName, helperContainerName),
+		Src:         localPath,
+		Dst:         remotePath,
+		Progress:    k.uploadProgress,
 	}
 
-	exitCode, err := PodUploadFile(req)
-	if err != nil || exitCode != 0 {
-		return errors.Wrapf(err, "upload file failed, exitCode: %d", exitCode)
+	exitCode, err := PodUploadFileViaProcRoot(ctx, req, containerId)
+	if err != nil {
+		return errors.Wrapf(err, "upload file through pod: '%s' failed", helperPodName)
 	}
 
+	if exitCode != 0 {
+		return errors.Errorf("upload file through pod: '%s' failed, exitCode: %d", helperPodName, exitCode)
+	}
+
+	// The helper pod may live in another namespace than the target
+	req.KubeRequest = k.kubeRequest(podName, containerName)
+
+	return k.verifyFileUploaded(ctx, req, localPath)
+}
+
+func (k *KubernetesApiServiceImpl) verifyFileUploaded(ctx context.Context, req UploadFileRequest, localPath string) error {
 	log.Info("verifying file uploaded successfully")
 
-	isExist, err = k.checkIfFileExistOnPod(remotePath, podName, containerName)
+	isExist, err := k.checkIfFileExistOnPod(ctx, req.Dst, req.Pod, req.Container)
 	if err != nil {
 		return err
 	}
@@ -302,7 +336,43 @@ func (k *KubernetesApiServiceImpl) UploadFile(localPath string, remotePath strin
 		return errors.New("couldn't locate file on pod after upload done")
 	}
 
+	result, err := verifyRemoteChecksum(ctx, req.KubeRequest, localPath, req.Dst)
+	if err != nil {
+		return err
+	}
+
+	if result == checksumMismatch {
+		return errors.Errorf("uploaded file: '%s' checksum doesn't match the local file", req.Dst)
+	}
+
 	log.Info("file uploaded successfully")
 
 	return nil
 }
+
+func uploadUsingStrategies(ctx context.Context, req UploadFileRequest, strategies []UploadStrategy) error {
+	var attempted []string
+
+	for _, strategy := range strategies {
+		if !strategy.IsAvailable(ctx, req.KubeRequest) {
+			log.Debugf("upload strategy: '%s' isn't available on container: '%s'", strategy.Name(), req.Container)
+			continue
+		}
+
+		log.Infof("uploading file using: '%s'", strategy.Name())
+
+		exitCode, err := strategy.Upload(ctx, req)
+		if err == nil && exitCode == 0 {
+			return nil
+		}
+
+		log.WithError(err).Warnf("upload file using: '%s' failed, exitCode: %d", strategy.Name(), exitCode)
+		attempted = append(attempted, strategy.Name())
+	}
+
+	if len(attempted) == 0 {
+		return ErrNoUploadStrategy
+	}
+
+	return errors.Wrapf(ErrUploadFailed, "attempted strategies: %v", attempted)
+}
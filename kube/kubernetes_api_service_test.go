@@ -0,0 +1,251 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"ksniff/pkg/service/sniffer/runtime"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type recordingExecutor struct {
+	commands   [][]string
+	namespaces []string
+	output     string
+}
+
+func (r *recordingExecutor) Execute(ctx context.Context, req ExecCommandRequest) (int, error) {
+	r.commands = append(r.commands, req.Command)
+	r.namespaces = append(r.namespaces, req.Namespace)
+	if req.StdOut != nil {
+		_, _ = io.WriteString(req.StdOut, r.output)
+	}
+	return 0, nil
+}
+
+func newNode(name string, containerRuntime string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+		Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{ContainerRuntimeVersion: containerRuntime}},
+	}
+}
+
+// newFakeClientset names created pods after their generate name and, when running is set, starts them
+func newFakeClientset(running bool, objects ...k8sruntime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		if pod.Name == "" {
+			pod.Name = pod.GenerateName + "fake"
+		}
+		if running {
+			pod.Status.Phase = corev1.PodRunning
+		}
+		return false, nil, nil
+	})
+
+	return clientset
+}
+
+func TestCreatePrivilegedPod(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"))
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.LegacyHelperRequirements("/run/containerd/containerd.sock"), time.Second, "sniffer", PrivilegedPodOptions{})
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "ksniff-fake", pod.Name)
+	assert.Equal(t, "namespace", pod.Namespace)
+	assert.Equal(t, "ksniff", pod.Labels["app"])
+	assert.Equal(t, "node", pod.Spec.NodeName)
+	assert.Equal(t, "sniffer", pod.Spec.ServiceAccountName)
+	assert.True(t, pod.Spec.HostPID)
+	assert.False(t, pod.Spec.HostNetwork)
+	assert.Equal(t, corev1.RestartPolicyNever, pod.Spec.RestartPolicy)
+
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "ksniff-privileged", container.Name)
+	assert.Equal(t, "docker", container.Image)
+	assert.True(t, *container.SecurityContext.Privileged)
+	assert.Equal(t, []string{"/host", "/run/containerd/containerd.sock"},
+		[]string{container.VolumeMounts[0].MountPath, container.VolumeMounts[1].MountPath})
+	assert.Equal(t, "/run/containerd/containerd.sock", pod.Spec.Volumes[1].HostPath.Path)
+	assert.Equal(t, TolerateAll, pod.Spec.Tolerations)
+	assert.Equal(t, DefaultPrivilegedPodResources(), container.Resources)
+}
+
+func TestCreatePrivilegedPod_Options(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"))
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+	options := PrivilegedPodOptions{
+		Tolerations:       []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}},
+		NodeSelector:      map[string]string{"pool": "infra"},
+		ImagePullSecrets:  []string{"registry"},
+		PriorityClassName: "system-node-critical",
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+		Labels:      map[string]string{"team": "network", "app": "other"},
+		Annotations: map[string]string{"owner": "network"},
+		Patch:       []byte("spec:\n  containers:\n  - name: ksniff-privileged\n    env:\n    - name: DEBUG\n      value: \"1\"\n"),
+	}
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker", runtime.HelperRequirements{}, time.Second, "", options)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, options.Tolerations, pod.Spec.Tolerations)
+	assert.Equal(t, options.NodeSelector, pod.Spec.NodeSelector)
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry"}}, pod.Spec.ImagePullSecrets)
+	assert.Equal(t, "system-node-critical", pod.Spec.PriorityClassName)
+	assert.Equal(t, "network", pod.Labels["team"])
+	assert.Equal(t, "ksniff", pod.Labels["app"], "the ksniff labels are kept")
+	assert.Equal(t, "network", pod.Annotations["owner"])
+
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "1Gi", container.Resources.Limits.Memory().String())
+	assert.Equal(t, "1", container.Resources.Limits.Cpu().String())
+	assert.Equal(t, "128Mi", container.Resources.Requests.Memory().String())
+	assert.Equal(t, []corev1.EnvVar{{Name: "DEBUG", Value: "1"}}, container.Env)
+	assert.Equal(t, "docker", container.Image, "the patch is merged into the generated container")
+}
+
+func TestCreatePrivilegedPod_InvalidPatch(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"))
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	_, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker", runtime.HelperRequirements{}, time.Second, "",
+		PrivilegedPodOptions{Patch: []byte("spec: [")})
+
+	// then
+	assert.NotNil(t, err)
+	pods, _ := clientset.CoreV1().Pods("namespace").List(context.Background(), v1.ListOptions{})
+	assert.Empty(t, pods.Items)
+}
+
+func TestCreatePrivilegedPod_Capabilities(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"))
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+	requirements := runtime.HelperRequirements{
+		HostNetwork:  true,
+		Capabilities: []corev1.Capability{"NET_RAW", "NET_ADMIN"},
+		HostPaths:    []runtime.HostPathMount{runtime.HostRootMount(true)},
+	}
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker", requirements, time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.Nil(t, err)
+	assert.True(t, pod.Spec.HostNetwork)
+	assert.False(t, pod.Spec.HostPID)
+	assert.Equal(t, "", pod.Spec.ServiceAccountName)
+
+	container := pod.Spec.Containers[0]
+	assert.Nil(t, container.SecurityContext.Privileged)
+	assert.Equal(t, []corev1.Capability{"NET_RAW", "NET_ADMIN"}, container.SecurityContext.Capabilities.Add)
+	assert.Len(t, pod.Spec.Volumes, 1)
+	assert.Equal(t, "/", pod.Spec.Volumes[0].HostPath.Path)
+	assert.Equal(t, corev1.HostPathDirectory, *pod.Spec.Volumes[0].HostPath.Type)
+	assert.True(t, container.VolumeMounts[0].ReadOnly)
+}
+
+func TestCreatePrivilegedPod_UnsupportedRuntime(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "rkt://1.0"))
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	_, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker", runtime.HelperRequirements{}, time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.NotNil(t, err)
+	pods, _ := clientset.CoreV1().Pods("namespace").List(context.Background(), v1.ListOptions{})
+	assert.Empty(t, pods.Items)
+}
+
+func TestCreatePrivilegedPod_Timeout(t *testing.T) {
+	// given
+	clientset := newFakeClientset(false, newNode("node", "docker://19.3.1"))
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker", runtime.HelperRequirements{}, 10*time.Millisecond, "", PrivilegedPodOptions{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Equal(t, "ksniff-fake", pod.Name, "the pod is returned so it can be deleted")
+}
+
+func TestDeletePod(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "ksniff-fake", Namespace: "namespace"}})
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	err := service.DeletePod(context.Background(), "ksniff-fake")
+
+	// then
+	assert.Nil(t, err)
+	pods, _ := clientset.CoreV1().Pods("namespace").List(context.Background(), v1.ListOptions{})
+	assert.Empty(t, pods.Items)
+}
+
+func TestExecuteCommand_Executor(t *testing.T) {
+	// given
+	executor := &recordingExecutor{output: "output"}
+	service := NewKubernetesApiServiceWithExecutor(fake.NewSimpleClientset(), nil, "namespace", executor, nil)
+	stdOut := new(Writer)
+
+	// when
+	exitCode, err := service.ExecuteCommand(context.Background(), "pod", "container", []string{"tcpdump", "--version"}, stdOut)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "output", stdOut.Output)
+	assert.Equal(t, [][]string{{"tcpdump", "--version"}}, executor.commands)
+}
+
+func TestCreatePrivilegedPod_HelperNamespace(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"))
+	executor := &recordingExecutor{}
+	service := NewKubernetesApiServiceWithExecutor(clientset, nil, "namespace", executor, nil)
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker", runtime.HelperRequirements{}, time.Second, "",
+		PrivilegedPodOptions{Namespace: "ksniff-system"})
+	_, helperErr := service.ExecuteCommand(context.Background(), pod.Name, "ksniff-privileged", []string{"true"}, &NopWriter{})
+	_, targetErr := service.ExecuteCommand(context.Background(), "pod", "container", []string{"true"}, &NopWriter{})
+	deleteErr := service.DeletePod(context.Background(), pod.Name)
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, helperErr)
+	assert.Nil(t, targetErr)
+	assert.Nil(t, deleteErr)
+	assert.Equal(t, "ksniff-system", pod.Namespace)
+	assert.Equal(t, []string{"ksniff-system", "namespace"}, executor.namespaces)
+	pods, _ := clientset.CoreV1().Pods("ksniff-system").List(context.Background(), v1.ListOptions{})
+	assert.Empty(t, pods.Items)
+}
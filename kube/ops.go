@@ -1,28 +1,55 @@
 package kube
 
 import (
-	"bytes"
+	"context"
 	"io"
-	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
 	"path"
+	"sync"
+
+	"github.com/pkg/errors"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
 	utilexec "k8s.io/client-go/util/exec"
 )
 
+// CommandExecutor runs commands in containers, allowing the exec streams to be replaced in tests
+type CommandExecutor interface {
+	Execute(ctx context.Context, req ExecCommandRequest) (int, error)
+}
+
 type KubeRequest struct {
-	Clientset  *kubernetes.Clientset
+	Clientset  kubernetes.Interface
 	RestConfig *rest.Config
 	Namespace  string
 	Pod        string
 	Container  string
+	// One of the ExecTransport values, auto when empty
+	ExecTransport string
+	// Runs the commands instead of the API server exec streams when set
+	Executor CommandExecutor
 }
 
+const (
+	ExecTransportAuto      = "auto"
+	ExecTransportSpdy      = "spdy"
+	ExecTransportWebsocket = "websocket"
+)
+
+var SupportedExecTransports = []string{ExecTransportAuto, ExecTransportSpdy, ExecTransportWebsocket}
+
+// Hosts that didn't accept a SPDY upgrade, so later commands go straight to the websocket transport
+var spdyUnsupportedHosts sync.Map
+
 type ExecCommandRequest struct {
 	KubeRequest
 	Command []string
@@ -33,8 +60,11 @@ type ExecCommandRequest struct {
 
 type UploadFileRequest struct {
 	KubeRequest
-	Src string
-	Dst string
+	Src      string
+	Dst      string
+	Compress bool
+	// Receives a progress bar of the upload when set
+	Progress io.Writer
 }
 
 func (w *NopWriter) Write(p []byte) (n int, err error) {
@@ -56,30 +86,46 @@ type Writer struct {
 	Output string
 }
 
-func PodUploadFile(req UploadFileRequest) (int, error) {
+func PodUploadFile(ctx context.Context, req UploadFileRequest) (int, error) {
 	stdOut := new(Writer)
 	stdErr := new(Writer)
 
 	log.Debugf("uploading file from: '%s' to '%s'", req.Src, req.Dst)
 
-	fileContent, err := ioutil.ReadFile(req.Src)
+	file, err := os.Open(req.Src)
 	if err != nil {
 		return 0, err
 	}
+	defer file.Close()
 
-	log.Debugf("read '%s' to memory, file size: '%d'", req.Src, len(fileContent))
-
-	destFileName := path.Base(req.Dst)
-	tarFile, err := WrapAsTar(destFileName, fileContent)
+	fileInfo, err := file.Stat()
 	if err != nil {
 		return 0, err
 	}
 
-	log.Debugf("formatted '%s' as tar, tar size: '%d'", req.Src, len(tarFile))
+	progress := NewProgress(req.Progress, path.Base(req.Dst), fileInfo.Size())
+	defer progress.Done()
 
-	stdIn := bytes.NewReader(tarFile)
+	// The tar archive is produced while it's being sent, never held in memory
+	stdIn, tarWriter := io.Pipe()
+	tarWritten := make(chan struct{})
+
+	// The tar writer reports to the progress, it has to be done before the progress is
+	defer func() {
+		_ = stdIn.Close()
+		<-tarWritten
+	}()
+
+	go func() {
+		defer close(tarWritten)
+		err := WriteTar(tarWriter, path.Base(req.Dst), progress.Reader(file), fileInfo.Size(), req.Compress)
+		_ = tarWriter.CloseWithError(err)
+	}()
 
 	tarCmd := []string{"tar", "-xf", "-"}
+	if req.Compress {
+		tarCmd = []string{"tar", "-xzf", "-"}
+	}
 
 	destDir := path.Dir(req.Dst)
 	if len(destDir) > 0 {
@@ -89,20 +135,14 @@ func PodUploadFile(req UploadFileRequest) (int, error) {
 	log.Debugf("executing tar: '%v'", tarCmd)
 
 	execTarRequest := ExecCommandRequest{
-		KubeRequest: KubeRequest{
-			Clientset:  req.Clientset,
-			RestConfig: req.RestConfig,
-			Namespace:  req.Namespace,
-			Pod:        req.Pod,
-			Container:  req.Container,
-		},
-		Command: tarCmd,
-		StdIn:   stdIn,
-		StdOut:  stdOut,
-		StdErr:  stdErr,
+		KubeRequest: req.KubeRequest,
+		Command:     tarCmd,
+		StdIn:       stdIn,
+		StdOut:      stdOut,
+		StdErr:      stdErr,
 	}
 
-	exitCode, err := PodExecuteCommand(execTarRequest)
+	exitCode, err := PodExecuteCommand(ctx, execTarRequest)
 
 	log.Debugf("done uploading file, exitCode: '%d', stdOut: '%s', stdErr: '%s'",
 		exitCode, stdOut.Output, stdErr.Output)
@@ -110,7 +150,11 @@ func PodUploadFile(req UploadFileRequest) (int, error) {
 	return exitCode, err
 }
 
-func PodExecuteCommand(req ExecCommandRequest) (int, error) {
+// PodExecuteCommand runs the command in the container, cancelling the context closes the stream
+func PodExecuteCommand(ctx context.Context, req ExecCommandRequest) (int, error) {
+	if req.Executor != nil {
+		return req.Executor.Execute(ctx, req)
+	}
 
 	execRequest := req.Clientset.CoreV1().RESTClient().Post().
 		Resource("pods").
@@ -127,18 +171,12 @@ func PodExecuteCommand(req ExecCommandRequest) (int, error) {
 		TTY:       false,
 	}, scheme.ParameterCodec)
 
-	exec, err := remotecommand.NewSPDYExecutor(req.RestConfig, "POST", execRequest.URL())
-	if err != nil {
-		return 0, err
+	err := streamExecRequest(ctx, req, execRequest.URL())
+	if ctx.Err() != nil {
+		// The stream error is only a side effect of the cancellation
+		return 0, ctx.Err()
 	}
 
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  req.StdIn,
-		Stdout: req.StdOut,
-		Stderr: req.StdErr,
-		Tty:    false,
-	})
-
 	var exitCode = 0
 
 	if err != nil {
@@ -150,3 +188,95 @@ func PodExecuteCommand(req ExecCommandRequest) (int, error) {
 
 	return exitCode, err
 }
+
+func IsSupportedExecTransport(transport string) bool {
+	for _, supported := range SupportedExecTransports {
+		if transport == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+func streamExecRequest(ctx context.Context, req ExecCommandRequest, execUrl *url.URL) error {
+	switch req.ExecTransport {
+	case ExecTransportSpdy:
+		_, err := spdyStream(ctx, req, execUrl)
+		return err
+	case ExecTransportWebsocket:
+		return websocketStream(ctx, req.RestConfig, execUrl, req.StdIn, req.StdOut, req.StdErr)
+	}
+
+	if _, unsupported := spdyUnsupportedHosts.Load(req.RestConfig.Host); unsupported {
+		return websocketStream(ctx, req.RestConfig, execUrl, req.StdIn, req.StdOut, req.StdErr)
+	}
+
+	upgradeFailed, err := spdyStream(ctx, req, execUrl)
+	if !upgradeFailed {
+		return err
+	}
+
+	// Nothing was streamed yet, the command can safely be sent again over the other transport
+	log.WithError(err).Infof("SPDY upgrade failed, falling back to websocket exec transport")
+
+	wsErr := websocketStream(ctx, req.RestConfig, execUrl, req.StdIn, req.StdOut, req.StdErr)
+	if wsErr != nil {
+		if _, ok := wsErr.(utilexec.ExitError); !ok {
+			return errors.Wrapf(wsErr, "both exec transports failed, spdy: '%v', websocket", err)
+		}
+	}
+
+	spdyUnsupportedHosts.Store(req.RestConfig.Host, true)
+
+	return wsErr
+}
+
+// spdyUpgradeTracker records whether the connection failed at the upgrade, before any stream was opened,
+// and closes the upgraded connection once the context is done.
+type spdyUpgradeTracker struct {
+	spdy.Upgrader
+	ctx    context.Context
+	failed bool
+}
+
+func (s *spdyUpgradeTracker) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := s.Upgrader.NewConnection(resp)
+	if err != nil {
+		s.failed = true
+		return conn, err
+	}
+
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			_ = conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+
+	return conn, nil
+}
+
+func spdyStream(ctx context.Context, req ExecCommandRequest, execUrl *url.URL) (bool, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(req.RestConfig)
+	if err != nil {
+		return false, err
+	}
+
+	tracker := &spdyUpgradeTracker{Upgrader: upgrader, ctx: ctx}
+
+	exec, err := remotecommand.NewSPDYExecutorForTransports(transport, tracker, "POST", execUrl)
+	if err != nil {
+		return false, err
+	}
+
+	err = exec.Stream(remotecommand.StreamOptions{
+		Stdin:  req.StdIn,
+		Stdout: req.StdOut,
+		Stderr: req.StdErr,
+		Tty:    false,
+	})
+
+	return tracker.failed, err
+}
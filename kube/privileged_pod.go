@@ -0,0 +1,288 @@
+package kube
+
+import (
+	"encoding/json"
+	"strings"
+
+	"ksniff/pkg/service/sniffer/runtime"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+)
+
+// PrivilegedPodOptions customizes the pods ksniff creates on the target node
+type PrivilegedPodOptions struct {
+	// Namespace of the pods, the target namespace when empty. Commands still run in the target pod namespace.
+	Namespace string
+	// Tolerate every taint when nil, so the pod runs on tainted nodes too
+	Tolerations []corev1.Toleration
+	// The pod is pinned to the target node anyway, mismatching selectors make it fail to start
+	NodeSelector      map[string]string
+	ImagePullSecrets  []string
+	PriorityClassName string
+	// Override the matching entries of the default requests and limits, see DefaultPrivilegedPodResources
+	Resources   corev1.ResourceRequirements
+	Labels      map[string]string
+	Annotations map[string]string
+	// Strategic merge patch, YAML or JSON, applied to the generated pod last
+	Patch []byte
+}
+
+// TolerateAll matches every taint
+var TolerateAll = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+
+func DefaultPrivilegedPodResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("0.1"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+	}
+}
+
+// ParseToleration parses a toleration written as key[=value][:effect], matching any value when none is given
+func ParseToleration(toleration string) (corev1.Toleration, error) {
+	result := corev1.Toleration{Operator: corev1.TolerationOpExists}
+
+	keyValue := toleration
+	if i := strings.LastIndex(toleration, ":"); i != -1 {
+		keyValue = toleration[:i]
+		result.Effect = corev1.TaintEffect(toleration[i+1:])
+
+		switch result.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return result, errors.Errorf("invalid toleration: '%s', unknown effect: '%s'", toleration, result.Effect)
+		}
+	}
+
+	if i := strings.Index(keyValue, "="); i != -1 {
+		result.Operator = corev1.TolerationOpEqual
+		result.Value = keyValue[i+1:]
+		keyValue = keyValue[:i]
+	}
+
+	if keyValue == "" {
+		return result, errors.Errorf("invalid toleration: '%s', key is empty", toleration)
+	}
+
+	result.Key = keyValue
+
+	return result, nil
+}
+
+// ParseResourceList parses the quantities of the given resources, skipping empty ones
+func ParseResourceList(quantities map[corev1.ResourceName]string) (corev1.ResourceList, error) {
+	resources := corev1.ResourceList{}
+
+	for name, quantity := range quantities {
+		if quantity == "" {
+			continue
+		}
+
+		parsed, err := resource.ParseQuantity(quantity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s quantity: '%s'", name, quantity)
+		}
+
+		resources[name] = parsed
+	}
+
+	return resources, nil
+}
+
+// BuildPrivilegedPod generates the spec of a helper pod on the given node, granting it the given requirements only
+func BuildPrivilegedPod(namespace string, nodeName string, containerName string, image string,
+	requirements runtime.HelperRequirements, serviceaccount string, options PrivilegedPodOptions) (*corev1.Pod, error) {
+	typeMetadata := v1.TypeMeta{
+		Kind:       "Pod",
+		APIVersion: "v1",
+	}
+
+	// https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
+	objectMetadata := v1.ObjectMeta{
+		GenerateName: "ksniff-",
+		Namespace:    namespace,
+		Labels: map[string]string{
+			"app":                    "ksniff",
+			"app.kubernetes.io/name": "ksniff",
+		},
+	}
+
+	securityContext := &corev1.SecurityContext{}
+	if requirements.Privileged {
+		privileged := true
+		securityContext.Privileged = &privileged
+	} else if len(requirements.Capabilities) > 0 {
+		securityContext.Capabilities = &corev1.Capabilities{Add: requirements.Capabilities}
+	}
+
+	privilegedContainer := corev1.Container{
+		Name:            containerName,
+		Image:           image,
+		ImagePullPolicy: "IfNotPresent",
+		SecurityContext: securityContext,
+		Command:         []string{"sh", "-c", "sleep 10000000"},
+	}
+
+	podSpecs := corev1.PodSpec{
+		NodeName:      nodeName,
+		RestartPolicy: corev1.RestartPolicyNever,
+		HostPID:       requirements.HostPID,
+		HostNetwork:   requirements.HostNetwork,
+	}
+
+	for _, hostPath := range requirements.HostPaths {
+		hostPathType := hostPath.Type
+
+		privilegedContainer.VolumeMounts = append(privilegedContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      hostPath.Name,
+			ReadOnly:  hostPath.ReadOnly,
+			MountPath: hostPath.MountPath,
+		})
+
+		podSpecs.Volumes = append(podSpecs.Volumes, corev1.Volume{
+			Name: hostPath.Name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: hostPath.HostPath,
+					Type: &hostPathType,
+				},
+			},
+		})
+	}
+
+	podSpecs.Containers = []corev1.Container{privilegedContainer}
+
+	if serviceaccount != "" {
+		podSpecs.ServiceAccountName = serviceaccount
+	}
+
+	pod := &corev1.Pod{
+		TypeMeta:   typeMetadata,
+		ObjectMeta: objectMetadata,
+		Spec:       podSpecs,
+	}
+
+	if err := options.apply(pod); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+// Validate rejects overridden requests above overridden limits, which the API server would reject
+func (o *PrivilegedPodOptions) Validate() error {
+	_, err := o.resources()
+	return err
+}
+
+// resources merges the overrides onto the default requests and limits. A default conflicting with an override
+// follows it, e.g. a request of 512Mi raises the default memory limit to 512Mi.
+func (o *PrivilegedPodOptions) resources() (corev1.ResourceRequirements, error) {
+	resources := DefaultPrivilegedPodResources()
+	for name, quantity := range o.Resources.Requests {
+		resources.Requests[name] = quantity
+	}
+	for name, quantity := range o.Resources.Limits {
+		resources.Limits[name] = quantity
+	}
+
+	for name, request := range resources.Requests {
+		limit, ok := resources.Limits[name]
+		if !ok || request.Cmp(limit) <= 0 {
+			continue
+		}
+
+		_, requestOverridden := o.Resources.Requests[name]
+		_, limitOverridden := o.Resources.Limits[name]
+
+		switch {
+		case requestOverridden && limitOverridden:
+			return resources, errors.Errorf("%s request: '%s' is above its limit: '%s'", name, request.String(), limit.String())
+		case requestOverridden:
+			resources.Limits[name] = request
+		default:
+			resources.Requests[name] = limit
+		}
+	}
+
+	return resources, nil
+}
+
+func (o *PrivilegedPodOptions) apply(pod *corev1.Pod) error {
+	pod.Spec.Tolerations = o.Tolerations
+	if o.Tolerations == nil {
+		pod.Spec.Tolerations = TolerateAll
+	}
+
+	pod.Spec.NodeSelector = o.NodeSelector
+	pod.Spec.PriorityClassName = o.PriorityClassName
+
+	for _, secret := range o.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secret})
+	}
+
+	resources, err := o.resources()
+	if err != nil {
+		return err
+	}
+
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Resources = resources
+	}
+
+	// The ksniff labels are kept, they're how leftover pods are found
+	for key, value := range o.Labels {
+		if _, ok := pod.Labels[key]; !ok {
+			pod.Labels[key] = value
+		}
+	}
+
+	if len(o.Annotations) > 0 && pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	for key, value := range o.Annotations {
+		pod.Annotations[key] = value
+	}
+
+	if len(o.Patch) == 0 {
+		return nil
+	}
+
+	return patchPod(pod, o.Patch)
+}
+
+func patchPod(pod *corev1.Pod, patch []byte) error {
+	patchJson, err := yaml.YAMLToJSON(patch)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse pod patch")
+	}
+
+	podJson, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	patchedJson, err := strategicpatch.StrategicMergePatch(podJson, patchJson, corev1.Pod{})
+	if err != nil {
+		return errors.Wrap(err, "failed to apply pod patch")
+	}
+
+	patched := corev1.Pod{}
+	if err := json.Unmarshal(patchedJson, &patched); err != nil {
+		return errors.Wrap(err, "failed to apply pod patch")
+	}
+
+	*pod = patched
+
+	return nil
+}
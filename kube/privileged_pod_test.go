@@ -0,0 +1,106 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseToleration(t *testing.T) {
+	tests := []struct {
+		toleration string
+		expected   corev1.Toleration
+	}{
+		{"gpu", corev1.Toleration{Key: "gpu", Operator: corev1.TolerationOpExists}},
+		{"gpu:NoSchedule", corev1.Toleration{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		{"dedicated=infra", corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "infra"}},
+		{"node.example.com/dedicated=infra:NoExecute", corev1.Toleration{Key: "node.example.com/dedicated",
+			Operator: corev1.TolerationOpEqual, Value: "infra", Effect: corev1.TaintEffectNoExecute}},
+	}
+
+	for _, test := range tests {
+		// when
+		toleration, err := ParseToleration(test.toleration)
+
+		// then
+		assert.Nil(t, err, test.toleration)
+		assert.Equal(t, test.expected, toleration, test.toleration)
+	}
+}
+
+func TestParseToleration_Invalid(t *testing.T) {
+	for _, toleration := range []string{"", "=value", "gpu:Never"} {
+		// when
+		_, err := ParseToleration(toleration)
+
+		// then
+		assert.NotNil(t, err, toleration)
+	}
+}
+
+func TestParseResourceList(t *testing.T) {
+	// when
+	resources, err := ParseResourceList(map[corev1.ResourceName]string{corev1.ResourceCPU: "500m", corev1.ResourceMemory: ""})
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "500m", resources.Cpu().String())
+	_, hasMemory := resources[corev1.ResourceMemory]
+	assert.False(t, hasMemory)
+}
+
+func TestParseResourceList_Invalid(t *testing.T) {
+	// when
+	_, err := ParseResourceList(map[corev1.ResourceName]string{corev1.ResourceMemory: "lots"})
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestPrivilegedPodOptions_Resources(t *testing.T) {
+	tests := []struct {
+		name             string
+		requests         corev1.ResourceList
+		limits           corev1.ResourceList
+		expectedRequests string
+		expectedLimits   string
+	}{
+		{"defaults", nil, nil, "128Mi", "256Mi"},
+		{"request only, above the default limit", corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")}, nil, "512Mi", "512Mi"},
+		{"request only, below the default limit", corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")}, nil, "64Mi", "256Mi"},
+		{"limit only, below the default request", nil, corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")}, "64Mi", "64Mi"},
+		{"request and limit", corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}, "512Mi", "1Gi"},
+	}
+
+	for _, test := range tests {
+		// given
+		options := PrivilegedPodOptions{Resources: corev1.ResourceRequirements{Requests: test.requests, Limits: test.limits}}
+
+		// when
+		resources, err := options.resources()
+
+		// then
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expectedRequests, resources.Requests.Memory().String(), test.name)
+		assert.Equal(t, test.expectedLimits, resources.Limits.Memory().String(), test.name)
+		assert.Equal(t, "100m", resources.Requests.Cpu().String(), test.name)
+	}
+}
+
+func TestPrivilegedPodOptions_ValidateRequestAboveLimit(t *testing.T) {
+	// given
+	options := PrivilegedPodOptions{Resources: corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+		Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+	}}
+
+	// when
+	err := options.Validate()
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cpu request: '2' is above its limit: '500m'")
+}
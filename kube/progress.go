@@ -0,0 +1,105 @@
+package kube
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+const progressRefreshInterval = 250 * time.Millisecond
+
+// Progress reports the bytes read through its readers as a progress bar with the transfer rate.
+// A Progress without an output doesn't report anything.
+type Progress struct {
+	output      io.Writer
+	name        string
+	total       int64
+	completed   int64
+	startedAt   time.Time
+	lastPrinted time.Time
+}
+
+func NewProgress(output io.Writer, name string, total int64) *Progress {
+	return &Progress{output: output, name: name, total: total, startedAt: time.Now()}
+}
+
+// Reader wraps the given reader, counting its bytes toward the progress
+func (p *Progress) Reader(reader io.Reader) io.Reader {
+	if p.output == nil {
+		return reader
+	}
+
+	return &progressReader{reader: reader, progress: p}
+}
+
+// SetCompleted moves the progress to the given amount of bytes, e.g. when resuming
+func (p *Progress) SetCompleted(completed int64) {
+	p.completed = completed
+}
+
+// Done terminates the progress bar line
+func (p *Progress) Done() {
+	if p.output == nil {
+		return
+	}
+
+	p.print()
+	_, _ = fmt.Fprintln(p.output)
+}
+
+func (p *Progress) add(n int) {
+	p.completed += int64(n)
+
+	if time.Since(p.lastPrinted) >= progressRefreshInterval {
+		p.print()
+	}
+}
+
+func (p *Progress) print() {
+	p.lastPrinted = time.Now()
+
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = float64(p.completed) / float64(p.total)
+	}
+
+	filled := int(ratio * progressBarWidth)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+
+	rate := 0.0
+	if elapsed := time.Since(p.startedAt).Seconds(); elapsed > 0 {
+		rate = float64(p.completed) / elapsed
+	}
+
+	_, _ = fmt.Fprintf(p.output, "\r%s [%s%s] %3.0f%% %s/%s %s/s ", p.name,
+		strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+		ratio*100, FormatBytes(float64(p.completed)), FormatBytes(float64(p.total)), FormatBytes(rate))
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress *Progress
+}
+
+func (r *progressReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.progress.add(n)
+
+	return n, err
+}
+
+func FormatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
@@ -0,0 +1,250 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// https://kubernetes.io/docs/concepts/security/pod-security-admission/
+const (
+	PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+	PodSecurityLevelPrivileged = "privileged"
+	PodSecurityLevelBaseline   = "baseline"
+	PodSecurityLevelRestricted = "restricted"
+)
+
+// Matches the level in rejections like: violates PodSecurity "baseline:latest": host namespaces...
+var podSecurityRejectionLevel = regexp.MustCompile(`violates PodSecurity "([a-z]+)`)
+
+// Capabilities the baseline level allows to add, restricted allows NET_BIND_SERVICE only
+var baselineCapabilities = map[corev1.Capability]bool{
+	"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true, "KILL": true, "MKNOD": true,
+	"NET_BIND_SERVICE": true, "SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true, "SYS_CHROOT": true,
+}
+
+// PodSecurityError explains why the pod security admission of a namespace rejects the helper pod
+type PodSecurityError struct {
+	Namespace  string
+	Level      string
+	Violations []string
+	// Namespaces enforcing the privileged level, where the helper pod is admitted
+	PrivilegedNamespaces []string
+	Cause                error
+}
+
+func (e *PodSecurityError) Error() string {
+	var message strings.Builder
+
+	fmt.Fprintf(&message, "namespace: '%s' enforces the '%s' pod security level, which rejects the helper pod", e.Namespace, e.Level)
+	if len(e.Violations) > 0 {
+		fmt.Fprintf(&message, " (%s)", strings.Join(e.Violations, ", "))
+	}
+
+	message.WriteString(". alternatives: capture with the static tcpdump mode (without -p or --host-veth), which only " +
+		"executes in the target container; or create the helper pod in a namespace enforcing the 'privileged' level with --helper-namespace")
+	if len(e.PrivilegedNamespaces) > 0 {
+		fmt.Fprintf(&message, ", e.g. %s", strings.Join(e.PrivilegedNamespaces, ", "))
+	}
+
+	if e.Cause != nil {
+		fmt.Fprintf(&message, ": %s", e.Cause)
+	}
+
+	return message.String()
+}
+
+// PodSecurityViolations lists what keeps the pod from being admitted at the given pod security level
+func PodSecurityViolations(level string, pod *corev1.Pod) []string {
+	if level != PodSecurityLevelBaseline && level != PodSecurityLevelRestricted {
+		return nil
+	}
+
+	var violations []string
+
+	var hostNamespaces []string
+	if pod.Spec.HostNetwork {
+		hostNamespaces = append(hostNamespaces, "hostNetwork=true")
+	}
+	if pod.Spec.HostPID {
+		hostNamespaces = append(hostNamespaces, "hostPID=true")
+	}
+	if pod.Spec.HostIPC {
+		hostNamespaces = append(hostNamespaces, "hostIPC=true")
+	}
+	if len(hostNamespaces) > 0 {
+		violations = append(violations, fmt.Sprintf("host namespaces (%s)", strings.Join(hostNamespaces, ", ")))
+	}
+
+	var hostPathVolumes []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil {
+			hostPathVolumes = append(hostPathVolumes, fmt.Sprintf("'%s'", volume.Name))
+		}
+	}
+	if len(hostPathVolumes) > 0 {
+		violations = append(violations, fmt.Sprintf("hostPath volumes (%s)", strings.Join(hostPathVolumes, ", ")))
+	}
+
+	for _, container := range pod.Spec.Containers {
+		securityContext := container.SecurityContext
+		if securityContext == nil {
+			securityContext = &corev1.SecurityContext{}
+		}
+
+		if securityContext.Privileged != nil && *securityContext.Privileged {
+			violations = append(violations, fmt.Sprintf("privileged (container '%s')", container.Name))
+		}
+
+		var capabilities []string
+		if securityContext.Capabilities != nil {
+			for _, capability := range securityContext.Capabilities.Add {
+				if !baselineCapabilities[capability] || (level == PodSecurityLevelRestricted && capability != "NET_BIND_SERVICE") {
+					capabilities = append(capabilities, string(capability))
+				}
+			}
+		}
+		if len(capabilities) > 0 {
+			sort.Strings(capabilities)
+			violations = append(violations, fmt.Sprintf("capabilities (container '%s' adds %s)", container.Name, strings.Join(capabilities, ", ")))
+		}
+
+		if level != PodSecurityLevelRestricted {
+			continue
+		}
+
+		if !dropsAllCapabilities(securityContext.Capabilities) {
+			violations = append(violations, fmt.Sprintf("unrestricted capabilities (container '%s' must drop ALL)", container.Name))
+		}
+
+		if securityContext.AllowPrivilegeEscalation == nil || *securityContext.AllowPrivilegeEscalation {
+			violations = append(violations, fmt.Sprintf("allowPrivilegeEscalation != false (container '%s')", container.Name))
+		}
+
+		runAsNonRoot := securityContext.RunAsNonRoot
+		if runAsNonRoot == nil && pod.Spec.SecurityContext != nil {
+			runAsNonRoot = pod.Spec.SecurityContext.RunAsNonRoot
+		}
+		if runAsNonRoot == nil || !*runAsNonRoot {
+			violations = append(violations, fmt.Sprintf("runAsNonRoot != true (container '%s')", container.Name))
+		}
+
+		seccompProfile := securityContext.SeccompProfile
+		if seccompProfile == nil && pod.Spec.SecurityContext != nil {
+			seccompProfile = pod.Spec.SecurityContext.SeccompProfile
+		}
+		if seccompProfile == nil || seccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+			violations = append(violations, fmt.Sprintf("seccompProfile (container '%s' must use RuntimeDefault or Localhost)", container.Name))
+		}
+	}
+
+	return violations
+}
+
+func dropsAllCapabilities(capabilities *corev1.Capabilities) bool {
+	if capabilities == nil {
+		return false
+	}
+
+	for _, capability := range capabilities.Drop {
+		if capability == "ALL" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// podSecurityLevel returns the level the namespace enforces, empty when its labels can't be read
+func (k *KubernetesApiServiceImpl) podSecurityLevel(ctx context.Context, namespace string) string {
+	ns, err := k.clientset.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
+	if err != nil {
+		log.WithError(err).Debugf("failed to read pod security labels of namespace: '%s'", namespace)
+		return ""
+	}
+
+	level, ok := ns.Labels[PodSecurityEnforceLabel]
+	if !ok {
+		return PodSecurityLevelPrivileged
+	}
+
+	return level
+}
+
+// privilegedNamespaces returns the namespaces enforcing the privileged level, none when they can't be listed
+func (k *KubernetesApiServiceImpl) privilegedNamespaces(ctx context.Context) []string {
+	namespaces, err := k.clientset.CoreV1().Namespaces().List(ctx, v1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", PodSecurityEnforceLabel, PodSecurityLevelPrivileged),
+	})
+	if err != nil {
+		log.WithError(err).Debug("failed to list namespaces enforcing the privileged pod security level")
+		return nil
+	}
+
+	var names []string
+	for _, namespace := range namespaces.Items {
+		names = append(names, fmt.Sprintf("'%s'", namespace.Name))
+	}
+
+	return names
+}
+
+// checkPodSecurity predicts whether the pod security admission of the namespace admits the pod and, when the
+// namespace enforces a level, confirms it with a server side dry run, as exemptions may still admit it.
+func (k *KubernetesApiServiceImpl) checkPodSecurity(ctx context.Context, namespace string, pod *corev1.Pod) error {
+	level := k.podSecurityLevel(ctx, namespace)
+	if level != PodSecurityLevelBaseline && level != PodSecurityLevelRestricted {
+		return nil
+	}
+
+	violations := PodSecurityViolations(level, pod)
+	if len(violations) > 0 {
+		log.Warnf("namespace: '%s' enforces the '%s' pod security level, the helper pod violates: %s",
+			namespace, level, strings.Join(violations, ", "))
+	}
+
+	log.Debugf("validating pod with a server side dry run in namespace: '%s'", namespace)
+
+	_, err := k.clientset.CoreV1().Pods(namespace).Create(ctx, pod, v1.CreateOptions{DryRun: []string{v1.DryRunAll}})
+	if err != nil {
+		if isPodSecurityRejection(err) {
+			return &PodSecurityError{Namespace: namespace, Level: level, Violations: violations,
+				PrivilegedNamespaces: k.privilegedNamespaces(ctx), Cause: err}
+		}
+		return err
+	}
+
+	if len(violations) > 0 {
+		log.Infof("namespace: '%s' admitted the helper pod anyway, it's probably exempted", namespace)
+	}
+
+	return nil
+}
+
+// podSecurityRejection turns a rejection by the pod security admission into an actionable error
+func (k *KubernetesApiServiceImpl) podSecurityRejection(ctx context.Context, namespace string, pod *corev1.Pod, err error) error {
+	if !isPodSecurityRejection(err) {
+		return err
+	}
+
+	// The rejecting level may be a cluster wide default rather than a namespace label
+	level := k.podSecurityLevel(ctx, namespace)
+	if match := podSecurityRejectionLevel.FindStringSubmatch(err.Error()); match != nil {
+		level = match[1]
+	}
+
+	return &PodSecurityError{Namespace: namespace, Level: level, Violations: PodSecurityViolations(level, pod),
+		PrivilegedNamespaces: k.privilegedNamespaces(ctx), Cause: err}
+}
+
+func isPodSecurityRejection(err error) bool {
+	return apierrors.IsForbidden(err) && strings.Contains(err.Error(), "violates PodSecurity")
+}
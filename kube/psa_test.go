@@ -0,0 +1,169 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ksniff/pkg/service/sniffer/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newNamespace(name string, level string) *corev1.Namespace {
+	namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: name}}
+	if level != "" {
+		namespace.Labels = map[string]string{PodSecurityEnforceLabel: level}
+	}
+	return namespace
+}
+
+func buildPod(t *testing.T, requirements runtime.HelperRequirements) *corev1.Pod {
+	pod, err := BuildPrivilegedPod("namespace", "node", "ksniff-privileged", "docker", requirements, "", PrivilegedPodOptions{})
+	assert.Nil(t, err)
+	return pod
+}
+
+func podSecurityForbidden(level string) error {
+	return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "ksniff-fake",
+		errors.Errorf(`violates PodSecurity "%s:latest": host namespaces (hostPID=true)`, level))
+}
+
+func TestPodSecurityViolations_Privileged(t *testing.T) {
+	// when
+	violations := PodSecurityViolations(PodSecurityLevelPrivileged, buildPod(t, runtime.LegacyHelperRequirements("/var/run/docker.sock")))
+
+	// then
+	assert.Empty(t, violations)
+}
+
+func TestPodSecurityViolations_Baseline(t *testing.T) {
+	// when
+	violations := PodSecurityViolations(PodSecurityLevelBaseline, buildPod(t, runtime.LegacyHelperRequirements("/var/run/docker.sock")))
+
+	// then
+	assert.Equal(t, []string{
+		"host namespaces (hostPID=true)",
+		"hostPath volumes ('host', 'container-socket')",
+		"privileged (container 'ksniff-privileged')",
+	}, violations)
+}
+
+func TestPodSecurityViolations_BaselineCapabilities(t *testing.T) {
+	// given
+	pod := buildPod(t, runtime.HelperRequirements{Capabilities: []corev1.Capability{"SYS_CHROOT", "NET_RAW", "NET_ADMIN"}})
+
+	// when
+	violations := PodSecurityViolations(PodSecurityLevelBaseline, pod)
+
+	// then
+	assert.Equal(t, []string{"capabilities (container 'ksniff-privileged' adds NET_ADMIN, NET_RAW)"}, violations)
+}
+
+func TestPodSecurityViolations_Restricted(t *testing.T) {
+	// given
+	pod := buildPod(t, runtime.HelperRequirements{Capabilities: []corev1.Capability{"SYS_CHROOT"}})
+
+	// when
+	violations := PodSecurityViolations(PodSecurityLevelRestricted, pod)
+
+	// then
+	assert.Equal(t, []string{
+		"capabilities (container 'ksniff-privileged' adds SYS_CHROOT)",
+		"unrestricted capabilities (container 'ksniff-privileged' must drop ALL)",
+		"allowPrivilegeEscalation != false (container 'ksniff-privileged')",
+		"runAsNonRoot != true (container 'ksniff-privileged')",
+		"seccompProfile (container 'ksniff-privileged' must use RuntimeDefault or Localhost)",
+	}, violations)
+}
+
+func TestCreatePrivilegedPod_PodSecurityRejected(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"),
+		newNamespace("namespace", PodSecurityLevelBaseline), newNamespace("ksniff-system", PodSecurityLevelPrivileged))
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, nil, podSecurityForbidden(PodSecurityLevelBaseline)
+	})
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.LegacyHelperRequirements(""), time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.Nil(t, pod)
+	podSecurityErr, ok := err.(*PodSecurityError)
+	assert.True(t, ok)
+	assert.Equal(t, "namespace", podSecurityErr.Namespace)
+	assert.Equal(t, PodSecurityLevelBaseline, podSecurityErr.Level)
+	assert.Contains(t, podSecurityErr.Violations, "host namespaces (hostPID=true)")
+	assert.Equal(t, []string{"'ksniff-system'"}, podSecurityErr.PrivilegedNamespaces)
+	assert.Contains(t, err.Error(), "--helper-namespace, e.g. 'ksniff-system'")
+}
+
+func TestCreatePrivilegedPod_PodSecurityExempted(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"), newNamespace("namespace", PodSecurityLevelRestricted))
+	creates := 0
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		creates++
+		if creates == 1 {
+			// The dry run isn't persisted
+			return true, action.(k8stesting.CreateAction).GetObject(), nil
+		}
+		return false, nil, nil
+	})
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	pod, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.LegacyHelperRequirements(""), time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "ksniff-fake", pod.Name)
+	assert.Equal(t, 2, creates)
+}
+
+func TestCreatePrivilegedPod_PodSecurityClusterDefault(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"))
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, nil, podSecurityForbidden(PodSecurityLevelRestricted)
+	})
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	_, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.HelperRequirements{}, time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	podSecurityErr, ok := err.(*PodSecurityError)
+	assert.True(t, ok)
+	assert.Equal(t, PodSecurityLevelRestricted, podSecurityErr.Level)
+}
+
+func TestCreatePrivilegedPod_OtherRejection(t *testing.T) {
+	// given
+	clientset := newFakeClientset(true, newNode("node", "containerd://1.4.4"), newNamespace("namespace", PodSecurityLevelBaseline))
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		return true, nil, errors.New("admission webhook denied the request")
+	})
+	service := NewKubernetesApiService(clientset, nil, "namespace", ExecTransportAuto, nil)
+
+	// when
+	_, err := service.CreatePrivilegedPod(context.Background(), "node", "ksniff-privileged", "docker",
+		runtime.HelperRequirements{}, time.Second, "", PrivilegedPodOptions{})
+
+	// then
+	assert.NotNil(t, err)
+	_, ok := err.(*PodSecurityError)
+	assert.False(t, ok)
+}
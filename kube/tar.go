@@ -2,30 +2,41 @@ package kube
 
 import (
 	"archive/tar"
-	"bytes"
+	"compress/gzip"
+	"io"
 )
 
-func WrapAsTar(fileNameOnTar string, fileContent []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	tw := tar.NewWriter(&buf)
+// WriteTar streams a single file tar archive, optionally gzip compressed, to the given writer
+func WriteTar(w io.Writer, fileNameOnTar string, fileContent io.Reader, fileSize int64, compress bool) error {
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(w)
+		w = gzipWriter
+	}
+
+	tw := tar.NewWriter(w)
 
 	hdr := &tar.Header{
 		Name: fileNameOnTar,
 		Mode: 0755,
-		Size: int64(len(fileContent)),
+		Size: fileSize,
 	}
 
 	if err := tw.WriteHeader(hdr); err != nil {
-		return nil, err
+		return err
 	}
 
-	if _, err := tw.Write(fileContent); err != nil {
-		return nil, err
+	if _, err := io.Copy(tw, fileContent); err != nil {
+		return err
 	}
 
 	if err := tw.Close(); err != nil {
-		return nil, err
+		return err
+	}
+
+	if gzipWriter != nil {
+		return gzipWriter.Close()
 	}
 
-	return buf.Bytes(), nil
+	return nil
 }
@@ -0,0 +1,69 @@
+package kube
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readSingleFileTar(t *testing.T, archive io.Reader) (*tar.Header, string) {
+	tr := tar.NewReader(archive)
+
+	hdr, err := tr.Next()
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadAll(tr)
+	assert.Nil(t, err)
+
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+
+	return hdr, string(content)
+}
+
+func TestWriteTar(t *testing.T) {
+	// given
+	var archive bytes.Buffer
+
+	// when
+	err := WriteTar(&archive, "static-tcpdump", strings.NewReader("tcpdump"), 7, false)
+
+	// then
+	assert.Nil(t, err)
+	hdr, content := readSingleFileTar(t, &archive)
+	assert.Equal(t, "static-tcpdump", hdr.Name)
+	assert.Equal(t, int64(0755), hdr.Mode)
+	assert.Equal(t, "tcpdump", content)
+}
+
+func TestWriteTar_Compressed(t *testing.T) {
+	// given
+	var archive bytes.Buffer
+
+	// when
+	err := WriteTar(&archive, "static-tcpdump", strings.NewReader("tcpdump"), 7, true)
+
+	// then
+	assert.Nil(t, err)
+	gzipReader, err := gzip.NewReader(&archive)
+	assert.Nil(t, err)
+	_, content := readSingleFileTar(t, gzipReader)
+	assert.Equal(t, "tcpdump", content)
+}
+
+func TestWriteTar_SizeMismatch(t *testing.T) {
+	// given
+	var archive bytes.Buffer
+
+	// when
+	err := WriteTar(&archive, "static-tcpdump", strings.NewReader("tcpdump"), 3, false)
+
+	// then
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,431 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"ksniff/utils"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNoUploadStrategy = errors.New("no upload strategy is usable on the target container")
+
+// ErrUploadFailed is returned when the container had tools to receive the upload but every attempt failed
+var ErrUploadFailed = errors.New("every usable upload strategy failed on the target container")
+
+// UploadStrategy writes a local file into a container using one of the tools available in its image.
+type UploadStrategy interface {
+	Name() string
+
+	// IsAvailable cheaply probes the container for the tools the strategy relies on
+	IsAvailable(ctx context.Context, req KubeRequest) bool
+
+	// Upload writes the file and makes it executable
+	Upload(ctx context.Context, req UploadFileRequest) (int, error)
+}
+
+// Ordered by preference, the first available strategy that succeeds wins
+var DefaultUploadStrategies = []UploadStrategy{
+	&TarUploadStrategy{},
+	&ShellUploadStrategy{},
+	&DdUploadStrategy{},
+	&BusyboxBase64UploadStrategy{},
+}
+
+// probeCommand returns true when the command could be started in the container,
+// regardless of its exit code, unless the exit code is the shell's "not found"/"not executable".
+func probeCommand(ctx context.Context, req KubeRequest, command []string) bool {
+	exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     command,
+		StdOut:      &NopWriter{},
+		StdErr:      &NopWriter{},
+	})
+
+	log.Debugf("probing: '%v', exitCode: '%d', err: '%v'", command, exitCode, err)
+
+	return err == nil && exitCode != 126 && exitCode != 127
+}
+
+type TarUploadStrategy struct{}
+
+func (t *TarUploadStrategy) Name() string {
+	return "tar"
+}
+
+func (t *TarUploadStrategy) IsAvailable(ctx context.Context, req KubeRequest) bool {
+	return probeCommand(ctx, req, []string{"tar", "--help"})
+}
+
+func (t *TarUploadStrategy) Upload(ctx context.Context, req UploadFileRequest) (int, error) {
+	req.Compress = isGzipSupportedByTar(ctx, req.KubeRequest)
+	log.Debugf("tar gzip support: '%v'", req.Compress)
+
+	// tar restores the file mode, no chmod needed
+	return PodUploadFile(ctx, req)
+}
+
+// isGzipSupportedByTar feeds an empty compressed archive to the container tar
+func isGzipSupportedByTar(ctx context.Context, req KubeRequest) bool {
+	var archive bytes.Buffer
+	if err := WriteTar(&archive, "ksniff-probe", &bytes.Buffer{}, 0, true); err != nil {
+		return false
+	}
+
+	exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     []string{"tar", "-tzf", "-"},
+		StdIn:       &archive,
+		StdOut:      &NopWriter{},
+		StdErr:      &NopWriter{},
+	})
+
+	return err == nil && exitCode == 0
+}
+
+const uploadChunkSize = 1024 * 1024
+const uploadChunkRetries = 3
+
+// ShellUploadStrategy appends the file in chunks to a partial file, so an upload
+// interrupted by a slow or flaky link resumes where it stopped instead of starting over.
+type ShellUploadStrategy struct{}
+
+func (s *ShellUploadStrategy) Name() string {
+	return "sh"
+}
+
+func (s *ShellUploadStrategy) IsAvailable(ctx context.Context, req KubeRequest) bool {
+	return probeCommand(ctx, req, []string{"sh", "-c", "true"})
+}
+
+func (s *ShellUploadStrategy) Upload(ctx context.Context, req UploadFileRequest) (int, error) {
+	partPath := req.Dst + ".part"
+
+	file, err := os.Open(req.Src)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := remoteFileSize(ctx, req.KubeRequest, partPath)
+	if offset > fileInfo.Size() {
+		offset = 0
+	}
+
+	if offset > 0 {
+		log.Infof("resuming upload of: '%s' from byte: '%d'", req.Dst, offset)
+	}
+
+	progress := NewProgress(req.Progress, path.Base(req.Dst), fileInfo.Size())
+	progress.SetCompleted(offset)
+	defer progress.Done()
+
+	retries := 0
+
+	for offset < fileInfo.Size() {
+		chunkSize := fileInfo.Size() - offset
+		if chunkSize > uploadChunkSize {
+			chunkSize = uploadChunkSize
+		}
+
+		redirect := ">>"
+		if offset == 0 {
+			redirect = ">"
+		}
+
+		command := []string{"sh", "-c", fmt.Sprintf("cat %s %s", redirect, utils.ShellQuote(partPath))}
+		chunk := progress.Reader(io.NewSectionReader(file, offset, chunkSize))
+
+		exitCode, err := executeWithStdIn(ctx, req.KubeRequest, command, chunk)
+		if err == nil && exitCode == 0 {
+			offset += chunkSize
+			retries = 0
+			continue
+		}
+
+		if retries == uploadChunkRetries || ctx.Err() != nil {
+			return exitCode, err
+		}
+
+		retries++
+
+		// Only part of the chunk may have been written, continue from what the container has
+		offset = remoteFileSize(ctx, req.KubeRequest, partPath)
+		progress.SetCompleted(offset)
+
+		log.WithError(err).Warnf("upload chunk failed, exitCode: '%d', retrying from byte: '%d'", exitCode, offset)
+	}
+
+	partPath = utils.ShellQuote(partPath)
+	dst := utils.ShellQuote(req.Dst)
+
+	return executeQuietly(ctx, req.KubeRequest, []string{"sh", "-c", fmt.Sprintf("mv %s %s && chmod +x %s", partPath, dst, dst)})
+}
+
+// remoteFileSize returns the size of the given file in the container, 0 when it doesn't exist
+func remoteFileSize(ctx context.Context, req KubeRequest, remotePath string) int64 {
+	stdOut := new(Writer)
+
+	command := []string{"sh", "-c", fmt.Sprintf("wc -c < %s", utils.ShellQuote(remotePath))}
+
+	exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     command,
+		StdOut:      stdOut,
+		StdErr:      &NopWriter{},
+	})
+	if err != nil || exitCode != 0 {
+		return 0
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(stdOut.Output), 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return size
+}
+
+type DdUploadStrategy struct{}
+
+func (d *DdUploadStrategy) Name() string {
+	return "dd"
+}
+
+func (d *DdUploadStrategy) IsAvailable(ctx context.Context, req KubeRequest) bool {
+	return probeCommand(ctx, req, []string{"dd", "if=/dev/null", "of=/dev/null"})
+}
+
+func (d *DdUploadStrategy) Upload(ctx context.Context, req UploadFileRequest) (int, error) {
+	exitCode, err := uploadFileContent(ctx, req, []string{"dd", "of=" + req.Dst}, false)
+	if err != nil || exitCode != 0 {
+		return exitCode, err
+	}
+
+	return executeQuietly(ctx, req.KubeRequest, []string{"chmod", "+x", req.Dst})
+}
+
+type BusyboxBase64UploadStrategy struct{}
+
+func (b *BusyboxBase64UploadStrategy) Name() string {
+	return "busybox base64"
+}
+
+func (b *BusyboxBase64UploadStrategy) IsAvailable(ctx context.Context, req KubeRequest) bool {
+	return probeCommand(ctx, req, []string{"busybox", "base64", "/dev/null"})
+}
+
+func (b *BusyboxBase64UploadStrategy) Upload(ctx context.Context, req UploadFileRequest) (int, error) {
+	dst := utils.ShellQuote(req.Dst)
+	command := []string{"busybox", "sh", "-c", fmt.Sprintf("busybox base64 -d > %s && busybox chmod +x %s", dst, dst)}
+
+	return uploadFileContent(ctx, req, command, true)
+}
+
+// uploadFileContent executes the given command, streaming the file content to its stdin
+func uploadFileContent(ctx context.Context, req UploadFileRequest, command []string, asBase64 bool) (int, error) {
+	file, err := os.Open(req.Src)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	progress := NewProgress(req.Progress, path.Base(req.Dst), fileInfo.Size())
+	defer progress.Done()
+
+	var stdIn io.Reader = progress.Reader(file)
+
+	if asBase64 {
+		pipeReader, pipeWriter := io.Pipe()
+		encoded := make(chan struct{})
+
+		// The encoder reports to the progress, it has to be done before the progress is
+		defer func() {
+			_ = pipeReader.Close()
+			<-encoded
+		}()
+
+		go func(content io.Reader) {
+			defer close(encoded)
+			encoder := base64.NewEncoder(base64.StdEncoding, pipeWriter)
+			_, err := io.Copy(encoder, content)
+			if err == nil {
+				err = encoder.Close()
+			}
+			_ = pipeWriter.CloseWithError(err)
+		}(stdIn)
+
+		stdIn = pipeReader
+	}
+
+	log.Debugf("executing: '%v' with '%d' bytes file on stdin", command, fileInfo.Size())
+
+	return executeWithStdIn(ctx, req.KubeRequest, command, stdIn)
+}
+
+func executeWithStdIn(ctx context.Context, req KubeRequest, command []string, stdIn io.Reader) (int, error) {
+	stdOut := new(Writer)
+	stdErr := new(Writer)
+
+	exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     command,
+		StdIn:       stdIn,
+		StdOut:      stdOut,
+		StdErr:      stdErr,
+	})
+
+	log.Debugf("done executing: '%v', exitCode: '%d', stdOut: '%s', stdErr: '%s'",
+		command, exitCode, stdOut.Output, stdErr.Output)
+
+	return exitCode, err
+}
+
+func executeQuietly(ctx context.Context, req KubeRequest, command []string) (int, error) {
+	return PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     command,
+		StdOut:      &NopWriter{},
+		StdErr:      &NopWriter{},
+	})
+}
+
+// Writes the file through the target container root filesystem as seen from a privileged
+// pod sharing the host PID namespace, locating the container process by its cgroup.
+const procRootUploadScript = `
+set -e
+pid=$(grep -l %s /proc/[0-9]*/cgroup 2>/dev/null | head -n 1 | cut -d / -f 3)
+if [ -z "$pid" ]; then
+    echo "no process found for container" >&2
+    exit 1
+fi
+cat > /proc/$pid/root%s
+chmod +x /proc/$pid/root%s
+`
+
+func PodUploadFileViaProcRoot(ctx context.Context, req UploadFileRequest, targetContainerId string) (int, error) {
+	dst := utils.ShellQuote(req.Dst)
+	script := fmt.Sprintf(procRootUploadScript, utils.ShellQuote(targetContainerId), dst, dst)
+
+	return uploadFileContent(ctx, req, []string{"/bin/sh", "-c", script}, false)
+}
+
+type checksumResult int
+
+const (
+	checksumUnverified checksumResult = iota
+	checksumMatch
+	checksumMismatch
+)
+
+type remoteChecksumCommand struct {
+	command       []string
+	localChecksum func(path string) (string, error)
+}
+
+// Ordered by preference, the first tool found on the container is used
+var remoteChecksumCommands = []remoteChecksumCommand{
+	{command: []string{"sha256sum"}, localChecksum: utils.FileSha256},
+	{command: []string{"busybox", "sha256sum"}, localChecksum: utils.FileSha256},
+	{command: []string{"md5sum"}, localChecksum: utils.FileMd5},
+	{command: []string{"busybox", "md5sum"}, localChecksum: utils.FileMd5},
+}
+
+// verifyRemoteChecksum compares the remote file against the local one, using whichever
+// checksum tool the container has, or else their sizes. The result is unverified when it can't tell.
+func verifyRemoteChecksum(ctx context.Context, req KubeRequest, localPath string, remotePath string) (checksumResult, error) {
+	for _, checksumCommand := range remoteChecksumCommands {
+		stdOut := new(Writer)
+		command := append(append([]string{}, checksumCommand.command...), remotePath)
+
+		exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+			KubeRequest: req,
+			Command:     command,
+			StdOut:      stdOut,
+			StdErr:      &NopWriter{},
+		})
+		if err != nil || exitCode == 126 || exitCode == 127 {
+			log.Debugf("checksum tool: '%v' isn't available", checksumCommand.command)
+			continue
+		}
+
+		if exitCode != 0 {
+			return checksumMismatch, nil
+		}
+
+		remoteFields := strings.Fields(stdOut.Output)
+		if len(remoteFields) == 0 {
+			return checksumMismatch, nil
+		}
+
+		localChecksum, err := checksumCommand.localChecksum(localPath)
+		if err != nil {
+			return checksumUnverified, err
+		}
+
+		log.Debugf("checksum using: '%v', local: '%s', remote: '%s'", checksumCommand.command, localChecksum, remoteFields[0])
+
+		if remoteFields[0] != localChecksum {
+			return checksumMismatch, nil
+		}
+
+		return checksumMatch, nil
+	}
+
+	// Containers without checksum tools are where uploads get interrupted, a truncated file is still told apart by its size
+	return verifyRemoteSize(ctx, req, localPath, remotePath)
+}
+
+// verifyRemoteSize compares the size of the remote file against the local one, unverified without wc
+func verifyRemoteSize(ctx context.Context, req KubeRequest, localPath string, remotePath string) (checksumResult, error) {
+	fileInfo, err := os.Stat(localPath)
+	if err != nil {
+		return checksumUnverified, err
+	}
+
+	stdOut := new(Writer)
+	exitCode, err := PodExecuteCommand(ctx, ExecCommandRequest{
+		KubeRequest: req,
+		Command:     []string{"wc", "-c", remotePath},
+		StdOut:      stdOut,
+		StdErr:      &NopWriter{},
+	})
+	if err != nil || exitCode == 126 || exitCode == 127 {
+		log.Debug("neither a checksum tool nor wc is available")
+		return checksumUnverified, nil
+	}
+
+	remoteFields := strings.Fields(stdOut.Output)
+	if exitCode != 0 || len(remoteFields) == 0 {
+		return checksumMismatch, nil
+	}
+
+	log.Debugf("no checksum tool available, comparing sizes, local: '%d', remote: '%s'", fileInfo.Size(), remoteFields[0])
+
+	if remoteFields[0] != strconv.FormatInt(fileInfo.Size(), 10) {
+		return checksumMismatch, nil
+	}
+
+	log.Warnf("no checksum tool available on the container, only the size of: '%s' was verified", remotePath)
+
+	return checksumMatch, nil
+}
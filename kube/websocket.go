@@ -0,0 +1,220 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// Channel based streaming protocols, v5 adds a way to close stdin which v4 lacks
+const (
+	websocketProtocolV5 = "v5.channel.k8s.io"
+	websocketProtocolV4 = "v4.channel.k8s.io"
+)
+
+// ErrWebsocketStdInUnsupported is returned when a command reading stdin runs over a protocol that can't close it,
+// the command would wait for the end of its input forever
+var ErrWebsocketStdInUnsupported = errors.New("the " + websocketProtocolV4 + " exec protocol can't close stdin, " +
+	"commands reading it would never complete")
+
+// Every websocket message starts with the byte of the stream it belongs to
+const (
+	streamStdIn  byte = 0
+	streamStdOut byte = 1
+	streamStdErr byte = 2
+	streamError  byte = 3
+	streamClose  byte = 255
+)
+
+// websocketRoundTripper dials the websocket itself, so the request goes through
+// the same authentication wrappers client-go applies to every other API call.
+type websocketRoundTripper struct {
+	dialer *websocket.Dialer
+	conn   *websocket.Conn
+}
+
+func (w *websocketRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, resp, err := w.dialer.DialContext(req.Context(), req.URL.String(), req.Header)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.Wrapf(err, "unable to upgrade connection to websocket, status: '%s'", resp.Status)
+		}
+		return nil, err
+	}
+
+	w.conn = conn
+
+	return resp, nil
+}
+
+func dialExecWebsocket(ctx context.Context, config *rest.Config, execUrl *url.URL) (*websocket.Conn, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = config.Proxy
+	}
+
+	roundTripper := &websocketRoundTripper{
+		dialer: &websocket.Dialer{
+			Proxy:           proxy,
+			TLSClientConfig: tlsConfig,
+			Subprotocols:    []string{websocketProtocolV5, websocketProtocolV4},
+		},
+	}
+
+	wrapper, err := rest.HTTPWrappersForConfig(config, roundTripper)
+	if err != nil {
+		return nil, err
+	}
+
+	wsUrl := *execUrl
+	switch wsUrl.Scheme {
+	case "https":
+		wsUrl.Scheme = "wss"
+	case "http":
+		wsUrl.Scheme = "ws"
+	}
+
+	// The exec subresource accepts websocket upgrades on GET only
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wsUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := wrapper.RoundTrip(req); err != nil {
+		return nil, err
+	}
+
+	return roundTripper.conn, nil
+}
+
+// websocketStream runs an exec over the channel.k8s.io websocket protocol. A non-zero
+// exit code is returned as an exec.ExitError, matching the SPDY executor.
+func websocketStream(ctx context.Context, config *rest.Config, execUrl *url.URL, stdIn io.Reader, stdOut io.Writer, stdErr io.Writer) error {
+	conn, err := dialExecWebsocket(ctx, config, execUrl)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	protocol := conn.Subprotocol()
+	log.Debugf("exec websocket connected using protocol: '%s'", protocol)
+
+	if stdIn != nil {
+		if protocol != websocketProtocolV5 {
+			return ErrWebsocketStdInUnsupported
+		}
+
+		go writeWebsocketStdIn(conn, stdIn)
+	}
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return err
+		}
+
+		if len(message) < 2 {
+			// Streams are announced with an empty message once open
+			continue
+		}
+
+		var output io.Writer
+		switch message[0] {
+		case streamStdOut:
+			output = stdOut
+		case streamStdErr:
+			output = stdErr
+		case streamError:
+			return parseWebsocketStatus(message[1:])
+		default:
+			log.Debugf("ignoring message on unknown stream: '%d'", message[0])
+		}
+
+		if output == nil {
+			continue
+		}
+
+		if _, err := output.Write(message[1:]); err != nil {
+			return err
+		}
+	}
+}
+
+func writeWebsocketStdIn(conn *websocket.Conn, stdIn io.Reader) {
+	buffer := make([]byte, 32*1024)
+
+	for {
+		n, err := stdIn.Read(buffer[1:])
+		if n > 0 {
+			buffer[0] = streamStdIn
+			if writeErr := conn.WriteMessage(websocket.BinaryMessage, buffer[:n+1]); writeErr != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	_ = conn.WriteMessage(websocket.BinaryMessage, []byte{streamClose, streamStdIn})
+}
+
+// parseWebsocketStatus converts the final status sent by the API server into an error
+func parseWebsocketStatus(message []byte) error {
+	var status metav1.Status
+	if err := json.Unmarshal(bytes.TrimSpace(message), &status); err != nil {
+		return errors.Wrapf(err, "failed to parse exec status: '%s'", string(message))
+	}
+
+	if status.Status == metav1.StatusSuccess {
+		return nil
+	}
+
+	if status.Reason == "NonZeroExitCode" && status.Details != nil {
+		for _, cause := range status.Details.Causes {
+			if cause.Type != "ExitCode" {
+				continue
+			}
+
+			exitCode, err := strconv.Atoi(cause.Message)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse exit code: '%s'", cause.Message)
+			}
+
+			return utilexec.CodeExitError{Err: errors.New(status.Message), Code: exitCode}
+		}
+	}
+
+	return errors.New(status.Message)
+}
@@ -0,0 +1,162 @@
+package kube
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const nonZeroExitStatus = `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"command terminated with non-zero exit code",
+"reason":"NonZeroExitCode","details":{"causes":[{"reason":"ExitCode","message":"3"}]}}`
+
+// newEchoExecServer answers exec requests over websocket only, echoing stdin back on stdout
+func newEchoExecServer(t *testing.T) *httptest.Server {
+	return newEchoExecServerWithProtocol(t, websocketProtocolV5)
+}
+
+func newEchoExecServerWithProtocol(t *testing.T, protocol string) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{protocol}}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			http.Error(w, "upgrade not allowed", http.StatusBadRequest)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.BinaryMessage, []byte{streamStdOut})
+
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if message[0] == streamClose {
+				break
+			}
+
+			_ = conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamStdOut}, message[1:]...))
+		}
+
+		_ = conn.WriteMessage(websocket.BinaryMessage, append([]byte{streamError}, nonZeroExitStatus...))
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+}
+
+func newExecRequest(t *testing.T, server *httptest.Server, transport string, stdOut *Writer) ExecCommandRequest {
+	restConfig := &rest.Config{Host: server.URL}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	assert.Nil(t, err)
+
+	return ExecCommandRequest{
+		KubeRequest: KubeRequest{
+			Clientset:     clientset,
+			RestConfig:    restConfig,
+			Namespace:     "default",
+			Pod:           "pod",
+			Container:     "container",
+			ExecTransport: transport,
+		},
+		Command: []string{"cat"},
+		StdIn:   strings.NewReader("ksniff"),
+		StdOut:  stdOut,
+		StdErr:  &NopWriter{},
+	}
+}
+
+func TestPodExecuteCommand_Websocket(t *testing.T) {
+	// given
+	server := newEchoExecServer(t)
+	defer server.Close()
+	stdOut := new(Writer)
+
+	// when
+	exitCode, err := PodExecuteCommand(context.Background(), newExecRequest(t, server, ExecTransportWebsocket, stdOut))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "ksniff", stdOut.Output)
+}
+
+func TestPodExecuteCommand_WebsocketV4WithStdIn(t *testing.T) {
+	// given
+	server := newEchoExecServerWithProtocol(t, websocketProtocolV4)
+	defer server.Close()
+
+	// when
+	_, err := PodExecuteCommand(context.Background(), newExecRequest(t, server, ExecTransportWebsocket, new(Writer)))
+
+	// then
+	assert.Equal(t, ErrWebsocketStdInUnsupported, errors.Cause(err))
+}
+
+func TestPodExecuteCommand_AutoFallsBackToWebsocket(t *testing.T) {
+	// given
+	server := newEchoExecServer(t)
+	defer server.Close()
+	stdOut := new(Writer)
+
+	// when
+	exitCode, err := PodExecuteCommand(context.Background(), newExecRequest(t, server, ExecTransportAuto, stdOut))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "ksniff", stdOut.Output)
+	_, unsupported := spdyUnsupportedHosts.Load(server.URL)
+	assert.True(t, unsupported)
+}
+
+func TestPodExecuteCommand_SpdyDoesNotFallBack(t *testing.T) {
+	// given
+	server := newEchoExecServer(t)
+	defer server.Close()
+
+	// when
+	_, err := PodExecuteCommand(context.Background(), newExecRequest(t, server, ExecTransportSpdy, new(Writer)))
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestParseWebsocketStatus_Success(t *testing.T) {
+	// when
+	err := parseWebsocketStatus([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestPodExecuteCommand_ContextCancelled(t *testing.T) {
+	// given
+	server := newEchoExecServer(t)
+	defer server.Close()
+	stdIn, stdInWriter := io.Pipe()
+	defer stdInWriter.Close()
+	req := newExecRequest(t, server, ExecTransportWebsocket, new(Writer))
+	req.StdIn = stdIn
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// when
+	_, err := PodExecuteCommand(ctx, req)
+
+	// then
+	assert.Equal(t, context.Canceled, err)
+}
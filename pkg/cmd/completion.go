@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ksniff/kube"
+	"ksniff/pkg/ksniff"
+	"ksniff/pkg/service/sniffer"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+const completionTimeout = 5 * time.Second
+
+// Prints the name of every network interface, for images without ls
+const listInterfacesScript = `for i in /sys/class/net/*; do echo "${i##*/}"; done`
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// NewCmdCompletion generates the completion script of the binary it runs as, e.g. kubectl-sniff when installed by krew
+func NewCmdCompletion(streams genericclioptions.IOStreams) *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate the shell completion script of ksniff.",
+		Long: "Generate the shell completion script of ksniff, completing pods, containers, namespaces, contexts and interfaces.\n\n" +
+			"  bash:       source <(kubectl-sniff completion bash)\n" +
+			"  zsh:        kubectl-sniff completion zsh > \"${fpath[1]}/_kubectl-sniff\"\n" +
+			"  fish:       kubectl-sniff completion fish > ~/.config/fish/completions/kubectl-sniff.fish\n" +
+			"  powershell: kubectl-sniff completion powershell | Out-String | Invoke-Expression",
+		ValidArgs:             completionShells,
+		Args:                  cobra.ExactValidArgs(1),
+		DisableFlagsInUseLine: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			root := c.Root()
+
+			// The scripts complete the command they're generated for, named after the root command
+			use := root.Use
+			root.Use = completionCommandName(os.Args[0])
+			defer func() {
+				root.Use = use
+			}()
+
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletion(streams.Out)
+			case "zsh":
+				return root.GenZshCompletion(streams.Out)
+			case "fish":
+				return root.GenFishCompletion(streams.Out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(streams.Out)
+			}
+
+			return errors.Errorf("unsupported shell: '%s'", args[0])
+		},
+	}
+}
+
+// completionCommandName returns the name the binary is invoked as
+func completionCommandName(arg0 string) string {
+	return strings.TrimSuffix(filepath.Base(arg0), ".exe")
+}
+
+func (o *Ksniff) registerCompletions(cmd *cobra.Command) {
+	cmd.ValidArgsFunction = o.completePods
+
+	_ = cmd.RegisterFlagCompletionFunc("container", o.completeContainers)
+	_ = cmd.RegisterFlagCompletionFunc("namespace", o.completeNamespaces)
+	_ = cmd.RegisterFlagCompletionFunc("context", o.completeContexts)
+	_ = cmd.RegisterFlagCompletionFunc("interface", o.completeInterfaces)
+	_ = cmd.RegisterFlagCompletionFunc("compress", staticCompletion(sniffer.SupportedCompressions))
+	_ = cmd.RegisterFlagCompletionFunc("exec-transport", staticCompletion(kube.SupportedExecTransports))
+}
+
+func staticCompletion(values []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return withPrefix(values, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completionClients connects to the cluster of the flags parsed so far, quietly as logs would garble the completions
+func (o *Ksniff) completionClients() (string, error) {
+	log.SetOutput(ioutil.Discard)
+
+	if o.clientset == nil {
+		o.settings.UserSpecifiedKubeContext = viper.GetString("context")
+		o.settings.UserSpecifiedNamespace = viper.GetString("namespace")
+
+		if err := o.buildClients(); err != nil {
+			return "", err
+		}
+	}
+
+	if o.resultingContext.Namespace == "" {
+		return "default", nil
+	}
+
+	return o.resultingContext.Namespace, nil
+}
+
+func (o *Ksniff) completePods(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	namespace, err := o.completionClients()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	pods, err := o.clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			names = append(names, pod.Name)
+		}
+	}
+
+	return withPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func (o *Ksniff) completeContainers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	pod, directive := o.completionPod(args)
+	if pod == nil {
+		return nil, directive
+	}
+
+	var names []string
+	for _, container := range containerChoices(pod) {
+		names = append(names, strings.Fields(container)[0])
+	}
+
+	return withPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func (o *Ksniff) completeNamespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if _, err := o.completionClients(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	namespaces, err := o.clientset.CoreV1().Namespaces().List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for _, namespace := range namespaces.Items {
+		names = append(names, namespace.Name)
+	}
+
+	return withPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func (o *Ksniff) completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	log.SetOutput(ioutil.Discard)
+
+	rawConfig, err := o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for name := range rawConfig.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return withPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInterfaces lists the interfaces of the target container, which needs ls or a shell
+func (o *Ksniff) completeInterfaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	pod, directive := o.completionPod(args)
+	if pod == nil {
+		return nil, directive
+	}
+
+	container := viper.GetString("container")
+	if container == "" {
+		container = ksniff.DefaultContainer(pod)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	service := kube.NewKubernetesApiService(o.clientset, o.restConfig, pod.Namespace, kube.ExecTransportAuto, nil)
+
+	names := []string{"any"}
+	for _, command := range [][]string{{"ls", "/sys/class/net"}, {"/bin/sh", "-c", listInterfacesScript}} {
+		var buff bytes.Buffer
+		exitCode, err := service.ExecuteCommand(ctx, pod.Name, container, command, &buff)
+		if err == nil && exitCode == 0 {
+			names = append(names, parseInterfaceNames(buff.String())...)
+			break
+		}
+	}
+
+	return withPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completionPod returns the pod given as argument, none when it's missing or can't be read
+func (o *Ksniff) completionPod(args []string) (*corev1.Pod, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	namespace, err := o.completionClients()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	pod, err := o.clientset.CoreV1().Pods(namespace).Get(ctx, args[0], v1.GetOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return pod, cobra.ShellCompDirectiveNoFileComp
+}
+
+func parseInterfaceNames(output string) []string {
+	var names []string
+	for _, name := range strings.Fields(output) {
+		// The glob is printed as is when it matches nothing
+		if name != "*" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func withPrefix(values []string, prefix string) []string {
+	var matching []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			matching = append(matching, value)
+		}
+	}
+
+	return matching
+}
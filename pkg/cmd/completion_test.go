@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestCompletePods(t *testing.T) {
+	// given
+	sniff := newPickingKsniff(
+		newPickerPod("frontend-7c77b68cff-qbvsd", corev1.PodRunning, "nginx"),
+		newPickerPod("backend-5d4f8b9c6-x2k9p", corev1.PodRunning, "app"),
+		newPickerPod("backend-migration-abcde", corev1.PodSucceeded, "migrate"),
+	)
+
+	// when
+	pods, directive := sniff.completePods(&cobra.Command{}, nil, "back")
+
+	// then
+	assert.Equal(t, []string{"backend-5d4f8b9c6-x2k9p"}, pods)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+}
+
+func TestCompletePods_AlreadyGiven(t *testing.T) {
+	// given
+	sniff := newPickingKsniff(newPickerPod("frontend-7c77b68cff-qbvsd", corev1.PodRunning, "nginx"))
+
+	// when
+	pods, _ := sniff.completePods(&cobra.Command{}, []string{"frontend-7c77b68cff-qbvsd"}, "")
+
+	// then
+	assert.Empty(t, pods)
+}
+
+func TestCompleteContainers(t *testing.T) {
+	// given
+	pod := newPickerPod("backend-5d4f8b9c6-x2k9p", corev1.PodRunning, "app", "envoy")
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{
+		{Name: "debugger", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+	sniff := newPickingKsniff(pod)
+
+	// when
+	containers, directive := sniff.completeContainers(&cobra.Command{}, []string{pod.Name}, "")
+
+	// then
+	assert.Equal(t, []string{"app", "envoy", "debugger"}, containers)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+}
+
+func TestCompleteContainers_MissingPod(t *testing.T) {
+	// given
+	sniff := newPickingKsniff()
+
+	// when
+	containers, directive := sniff.completeContainers(&cobra.Command{}, []string{"missing"}, "")
+
+	// then
+	assert.Empty(t, containers)
+	assert.Equal(t, cobra.ShellCompDirectiveError, directive)
+}
+
+func TestCompleteNamespaces(t *testing.T) {
+	// given
+	sniff := newPickingKsniff()
+	for _, name := range []string{"default", "kube-system", "kube-public"} {
+		_, _ = sniff.clientset.CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: name}}, v1.CreateOptions{})
+	}
+
+	// when
+	namespaces, _ := sniff.completeNamespaces(&cobra.Command{}, nil, "kube-")
+
+	// then
+	assert.Equal(t, []string{"kube-public", "kube-system"}, namespaces)
+}
+
+func TestParseInterfaceNames(t *testing.T) {
+	assert.Equal(t, []string{"eth0", "lo", "net1"}, parseInterfaceNames("eth0\nlo\nnet1\n"))
+	assert.Empty(t, parseInterfaceNames("*\n"))
+}
+
+func TestCompletionCommandName(t *testing.T) {
+	assert.Equal(t, "kubectl-sniff", completionCommandName("/home/user/.krew/bin/kubectl-sniff"))
+	assert.Equal(t, "kubectl-sniff", completionCommandName("kubectl-sniff.exe"))
+}
+
+func TestCompletionCommand(t *testing.T) {
+	// given
+	out := &bytes.Buffer{}
+	root := NewCmdSniff(genericclioptions.IOStreams{Out: out})
+	root.SetArgs([]string{"completion", "bash"})
+
+	// when
+	err := root.Execute()
+
+	// then
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "__complete")
+	assert.Equal(t, "sniff [pod] [-n namespace] [-c container] [-f filter] [-o output-file] [-l local-tcpdump-path] [-r remote-tcpdump-path]",
+		root.Use, "the root command is restored")
+}
+
+func TestCompletionCommand_UnknownShell(t *testing.T) {
+	// given
+	root := NewCmdSniff(genericclioptions.IOStreams{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}})
+	root.SetArgs([]string{"completion", "tcsh"})
+
+	// when
+	err := root.Execute()
+
+	// then
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"ksniff/pkg/ksniff"
+	"ksniff/pkg/service/sniffer"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdInterfaces lists the interfaces of the target container, sharing the target flags of the sniff command
+func NewCmdInterfaces(sniff *Ksniff) *cobra.Command {
+	return &cobra.Command{
+		Use:          "interfaces [pod] [-n namespace] [-c container]",
+		Short:        "List the network interfaces of a container, to pick the one to capture on with -i.",
+		Example:      "kubectl sniff interfaces hello-minikube-7c77b68cff-qbvsd -c hello-minikube",
+		SilenceUsage: true,
+		Args:         cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := sniff.Complete(c, args); err != nil {
+				return err
+			}
+
+			return sniff.ListInterfaces(c.Context())
+		},
+		ValidArgsFunction: sniff.completePods,
+	}
+}
+
+// ListInterfaces prints the interfaces of the network namespace of the target container
+func (o *Ksniff) ListInterfaces(ctx context.Context) error {
+	if len(o.rawConfig.CurrentContext) == 0 {
+		return errors.New("context doesn't exist")
+	}
+
+	// Listing may create a helper pod, which has to be removed on interrupt
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	s := ksniff.NewSniffer(o.clientset, o.restConfig, o.resultingContext.Namespace, o.settings, o.tcpdumpLookupPaths)
+
+	service, err := s.NewInterfacesService(ctx)
+	if err != nil {
+		return err
+	}
+
+	interfaces, err := service.List(ctx)
+	if cleanupErr := service.Cleanup(context.Background()); cleanupErr != nil {
+		log.WithError(cleanupErr).Error("failed to teardown interfaces listing, a manual teardown is required.")
+	}
+	if err != nil {
+		return err
+	}
+
+	printInterfaces(o.streams.Out, interfaces)
+
+	return nil
+}
+
+func printInterfaces(out io.Writer, interfaces []sniffer.NetworkInterface) {
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(writer, "NAME\tLINK\tMTU\tSTATE\tADDRESSES")
+	for _, networkInterface := range interfaces {
+		mtu := ""
+		if networkInterface.MTU > 0 {
+			mtu = strconv.Itoa(networkInterface.MTU)
+		}
+
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", networkInterface.Name, orUnknown(networkInterface.LinkType),
+			orUnknown(mtu), orUnknown(networkInterface.State), orUnknown(strings.Join(networkInterface.Addresses, ",")))
+	}
+	_ = writer.Flush()
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"ksniff/pkg/service/sniffer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintInterfaces(t *testing.T) {
+	// given
+	out := &bytes.Buffer{}
+	interfaces := []sniffer.NetworkInterface{
+		{Name: "eth0", LinkType: "ether", MTU: 1450, State: "up", Addresses: []string{"10.244.0.5/24", "fe80::858:aff:fef4:5/64"}},
+		{Name: "wg0", State: "down"},
+	}
+
+	// when
+	printInterfaces(out, interfaces)
+
+	// then
+	assert.Equal(t, "NAME  LINK   MTU   STATE  ADDRESSES\n"+
+		"eth0  ether  1450  up     10.244.0.5/24,fe80::858:aff:fef4:5/64\n"+
+		"wg0   -      -     down   -\n", out.String())
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ksniff/pkg/picker"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// isInteractive tells whether the pod can be picked from a list, which needs stdin to be a terminal
+func (o *Ksniff) isInteractive() bool {
+	in, ok := o.streams.In.(*os.File)
+	return ok && terminal.IsTerminal(int(in.Fd()))
+}
+
+// pickTarget lets the user choose the pod and, for pods with several containers, the container
+func (o *Ksniff) pickTarget(ctx context.Context) error {
+	in := o.streams.In.(*os.File)
+
+	state, err := terminal.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return errors.Wrap(err, "failed to switch the terminal to raw mode")
+	}
+
+	err = o.pick(ctx, picker.NewPicker(in, o.streams.ErrOut))
+	_ = terminal.Restore(int(in.Fd()), state)
+	if err != nil {
+		return err
+	}
+
+	// Logged once the terminal is restored, raw mode doesn't return the carriage on new lines
+	log.Infof("selected pod: '%s'", o.settings.UserSpecifiedPodName)
+
+	return nil
+}
+
+func (o *Ksniff) pick(ctx context.Context, p *picker.Picker) error {
+	namespace := o.resultingContext.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	podList, err := o.clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		// Completed pods can't be sniffed
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			pods = append(pods, pod)
+		}
+	}
+
+	if len(pods) == 0 {
+		return errors.Errorf("no running pod in namespace: '%s'", namespace)
+	}
+
+	header, rows := podRows(pods, time.Now())
+	index, err := p.Pick(fmt.Sprintf("pod in namespace: '%s'", namespace), header, rows)
+	if err != nil {
+		return err
+	}
+
+	pod := pods[index]
+	o.settings.UserSpecifiedPodName = pod.Name
+
+	if o.settings.UserSpecifiedContainer != "" {
+		return nil
+	}
+
+	containers := containerChoices(&pod)
+	if len(containers) < 2 {
+		return nil
+	}
+
+	index, err = p.Pick(fmt.Sprintf("container in pod: '%s'", pod.Name), "", containers)
+	if err != nil {
+		return err
+	}
+
+	o.settings.UserSpecifiedContainer = strings.Fields(containers[index])[0]
+
+	return nil
+}
+
+// podRows formats the pods as aligned rows with their status, node and restarts
+func podRows(pods []corev1.Pod, now time.Time) (string, []string) {
+	var buff bytes.Buffer
+	writer := tabwriter.NewWriter(&buff, 0, 8, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(writer, "NAME\tSTATUS\tNODE\tRESTARTS\tAGE")
+	for _, pod := range pods {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\n", pod.Name, podStatus(&pod), pod.Spec.NodeName,
+			podRestarts(&pod), duration.HumanDuration(now.Sub(pod.CreationTimestamp.Time)))
+	}
+	_ = writer.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(buff.String(), "\n"), "\n")
+
+	return strings.TrimRight(lines[0], " "), lines[1:]
+}
+
+// podStatus returns the reason a container waits or stopped when there's one, the pod phase otherwise
+func podStatus(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.State.Waiting != nil && containerStatus.State.Waiting.Reason != "" {
+			return containerStatus.State.Waiting.Reason
+		}
+		if containerStatus.State.Terminated != nil && containerStatus.State.Terminated.Reason != "" {
+			return containerStatus.State.Terminated.Reason
+		}
+	}
+
+	return string(pod.Status.Phase)
+}
+
+func podRestarts(pod *corev1.Pod) int32 {
+	var restarts int32
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		restarts += containerStatus.RestartCount
+	}
+
+	return restarts
+}
+
+// containerChoices lists the containers of the pod, followed by its running init and ephemeral containers
+func containerChoices(pod *corev1.Pod) []string {
+	var choices []string
+	for _, container := range pod.Spec.Containers {
+		choices = append(choices, container.Name)
+	}
+
+	running := func(kind string, statuses []corev1.ContainerStatus) {
+		for _, containerStatus := range statuses {
+			if containerStatus.State.Running != nil {
+				choices = append(choices, fmt.Sprintf("%s (%s)", containerStatus.Name, kind))
+			}
+		}
+	}
+	running("init", pod.Status.InitContainerStatuses)
+	running("ephemeral", pod.Status.EphemeralContainerStatuses)
+
+	return choices
+}
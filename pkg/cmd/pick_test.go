@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"ksniff/pkg/config"
+	"ksniff/pkg/picker"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+func newPickerPod(name string, phase corev1.PodPhase, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "namespace"},
+		Spec:       corev1.PodSpec{NodeName: "node"},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{Name: container, RestartCount: 1})
+	}
+	return pod
+}
+
+func newPickingKsniff(objects ...*corev1.Pod) *Ksniff {
+	clientset := fake.NewSimpleClientset()
+	for _, pod := range objects {
+		_ = clientset.Tracker().Add(pod)
+	}
+
+	sniff := NewKsniff(config.NewKsniffSettings())
+	sniff.clientset = clientset
+	sniff.resultingContext = &api.Context{Namespace: "namespace"}
+
+	return sniff
+}
+
+func TestComplete_NotEnoughArgumentsWithoutTerminal(t *testing.T) {
+	// given
+	sniff := NewKsniff(config.NewKsniffSettings())
+	sniff.streams.In = strings.NewReader("")
+
+	// when
+	err := sniff.Complete(NewCmdSniff(sniff.streams), nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not enough arguments")
+}
+
+func TestPick_PodAndContainer(t *testing.T) {
+	// given
+	sniff := newPickingKsniff(
+		newPickerPod("frontend-7c77b68cff-qbvsd", corev1.PodRunning, "nginx"),
+		newPickerPod("backend-5d4f8b9c6-x2k9p", corev1.PodRunning, "app", "envoy"),
+		newPickerPod("migration-job-abcde", corev1.PodSucceeded, "migrate"),
+	)
+
+	// when
+	err := sniff.pick(context.Background(), picker.NewPicker(strings.NewReader("back\renv\r"), &bytes.Buffer{}))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "backend-5d4f8b9c6-x2k9p", sniff.settings.UserSpecifiedPodName)
+	assert.Equal(t, "envoy", sniff.settings.UserSpecifiedContainer)
+}
+
+func TestPick_SingleContainer(t *testing.T) {
+	// given
+	sniff := newPickingKsniff(newPickerPod("frontend-7c77b68cff-qbvsd", corev1.PodRunning, "nginx"))
+
+	// when
+	err := sniff.pick(context.Background(), picker.NewPicker(strings.NewReader("\r"), &bytes.Buffer{}))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "frontend-7c77b68cff-qbvsd", sniff.settings.UserSpecifiedPodName)
+	assert.Equal(t, "", sniff.settings.UserSpecifiedContainer)
+}
+
+func TestPick_NoRunningPod(t *testing.T) {
+	// given
+	sniff := newPickingKsniff(newPickerPod("migration-job-abcde", corev1.PodSucceeded, "migrate"))
+
+	// when
+	err := sniff.pick(context.Background(), picker.NewPicker(strings.NewReader("\r"), &bytes.Buffer{}))
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no running pod")
+}
+
+func TestPodRows(t *testing.T) {
+	// given
+	pod := newPickerPod("frontend", corev1.PodRunning, "nginx", "envoy")
+	now := time.Now()
+	pod.CreationTimestamp = v1.NewTime(now.Add(-5 * time.Hour))
+	pod.Status.ContainerStatuses[1].State.Waiting = &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+
+	// when
+	header, rows := podRows([]corev1.Pod{*pod}, now)
+
+	// then
+	assert.Equal(t, "NAME      STATUS            NODE  RESTARTS  AGE", header)
+	assert.Equal(t, []string{"frontend  CrashLoopBackOff  node  2         5h"}, rows)
+}
+
+func TestContainerChoices(t *testing.T) {
+	// given
+	pod := newPickerPod("pod", corev1.PodRunning, "app")
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "migrate", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+		{Name: "proxy", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{
+		{Name: "debugger", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+
+	// when
+	choices := containerChoices(pod)
+
+	// then
+	assert.Equal(t, []string{"app", "proxy (init)", "debugger (ephemeral)"}, choices)
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"ksniff/kube"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// privilegedPodConfig is the privileged-pod section of the ksniff config file, flags take precedence over it
+type privilegedPodConfig struct {
+	Namespace string `json:"namespace"`
+	// An empty list tolerates no taint, every taint is tolerated when missing
+	Tolerations      []corev1.Toleration         `json:"tolerations"`
+	NodeSelector     map[string]string           `json:"node-selector"`
+	ImagePullSecrets []string                    `json:"image-pull-secrets"`
+	PriorityClass    string                      `json:"priority-class"`
+	Resources        corev1.ResourceRequirements `json:"resources"`
+	Labels           map[string]string           `json:"labels"`
+	Annotations      map[string]string           `json:"annotations"`
+	// Relative to the config file directory
+	PatchFile string `json:"patch-file"`
+}
+
+type ksniffConfig struct {
+	PrivilegedPod privilegedPodConfig `json:"privileged-pod"`
+}
+
+type privilegedPodResourceFlag struct {
+	name     string
+	env      string
+	resource corev1.ResourceName
+	kind     string
+	example  string
+}
+
+var privilegedPodResourceFlags = []privilegedPodResourceFlag{
+	{"pod-cpu-request", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_CPU_REQUEST", corev1.ResourceCPU, "request", "100m"},
+	{"pod-memory-request", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_MEMORY_REQUEST", corev1.ResourceMemory, "request", "128Mi"},
+	{"pod-cpu-limit", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_CPU_LIMIT", corev1.ResourceCPU, "limit", "1"},
+	{"pod-memory-limit", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_MEMORY_LIMIT", corev1.ResourceMemory, "limit", "256Mi"},
+}
+
+// readKsniffConfig reads the given config file, an empty config when it doesn't exist
+func readKsniffConfig(path string) (*ksniffConfig, error) {
+	config := &ksniffConfig{}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Debugf("config file: '%s' doesn't exist", path)
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file: '%s'", path)
+	}
+
+	if config.PrivilegedPod.PatchFile != "" {
+		patchFile, err := homedir.Expand(config.PrivilegedPod.PatchFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if !filepath.IsAbs(patchFile) {
+			patchFile = filepath.Join(filepath.Dir(path), patchFile)
+		}
+
+		config.PrivilegedPod.PatchFile = patchFile
+	}
+
+	return config, nil
+}
+
+func (o *Ksniff) loadPrivilegedPodOptions() error {
+	userHomeDir, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+
+	config, err := readKsniffConfig(filepath.Join(userHomeDir, filepath.FromSlash(configFile)))
+	if err != nil {
+		return err
+	}
+
+	o.settings.PrivilegedPodOptions, err = buildPrivilegedPodOptions(config.PrivilegedPod)
+
+	return err
+}
+
+// buildPrivilegedPodOptions overrides the given config with the flags set by the user
+func buildPrivilegedPodOptions(config privilegedPodConfig) (kube.PrivilegedPodOptions, error) {
+	options := kube.PrivilegedPodOptions{
+		Namespace:         config.Namespace,
+		Tolerations:       config.Tolerations,
+		NodeSelector:      config.NodeSelector,
+		ImagePullSecrets:  config.ImagePullSecrets,
+		PriorityClassName: config.PriorityClass,
+		Resources:         config.Resources,
+		Labels:            config.Labels,
+		Annotations:       config.Annotations,
+	}
+
+	if viper.IsSet("helper-namespace") {
+		options.Namespace = viper.GetString("helper-namespace")
+	}
+
+	if viper.IsSet("pod-toleration") {
+		options.Tolerations = []corev1.Toleration{}
+
+		for _, toleration := range viper.GetStringSlice("pod-toleration") {
+			parsed, err := kube.ParseToleration(toleration)
+			if err != nil {
+				return options, err
+			}
+			options.Tolerations = append(options.Tolerations, parsed)
+		}
+	}
+
+	if viper.IsSet("pod-node-selector") {
+		options.NodeSelector = viper.GetStringMapString("pod-node-selector")
+	}
+
+	if viper.IsSet("image-pull-secret") {
+		options.ImagePullSecrets = viper.GetStringSlice("image-pull-secret")
+	}
+
+	if viper.IsSet("pod-priority-class") {
+		options.PriorityClassName = viper.GetString("pod-priority-class")
+	}
+
+	requests := map[corev1.ResourceName]string{}
+	limits := map[corev1.ResourceName]string{}
+	for _, flag := range privilegedPodResourceFlags {
+		if flag.kind == "request" {
+			requests[flag.resource] = viper.GetString(flag.name)
+		} else {
+			limits[flag.resource] = viper.GetString(flag.name)
+		}
+	}
+
+	if err := mergeResourceList(&options.Resources.Requests, requests); err != nil {
+		return options, err
+	}
+
+	if err := mergeResourceList(&options.Resources.Limits, limits); err != nil {
+		return options, err
+	}
+
+	if viper.IsSet("pod-label") {
+		options.Labels = viper.GetStringMapString("pod-label")
+	}
+
+	if viper.IsSet("pod-annotation") {
+		options.Annotations = viper.GetStringMapString("pod-annotation")
+	}
+
+	patchFile := config.PatchFile
+	if viper.IsSet("pod-patch") {
+		patchFile = viper.GetString("pod-patch")
+	}
+
+	if patchFile != "" {
+		patch, err := ioutil.ReadFile(patchFile)
+		if err != nil {
+			return options, errors.Wrapf(err, "failed to read pod patch file: '%s'", patchFile)
+		}
+		options.Patch = patch
+	}
+
+	return options, nil
+}
+
+func mergeResourceList(resources *corev1.ResourceList, quantities map[corev1.ResourceName]string) error {
+	parsed, err := kube.ParseResourceList(quantities)
+	if err != nil {
+		return err
+	}
+
+	if len(parsed) > 0 && *resources == nil {
+		*resources = corev1.ResourceList{}
+	}
+
+	for name, quantity := range parsed {
+		(*resources)[name] = quantity
+	}
+
+	return nil
+}
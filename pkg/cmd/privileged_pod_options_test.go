@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const privilegedPodConfigFile = `
+privileged-pod:
+  tolerations:
+  - key: gpu
+    operator: Exists
+    effect: NoSchedule
+  image-pull-secrets: [registry]
+  priority-class: system-node-critical
+  resources:
+    limits:
+      memory: 1Gi
+  labels:
+    team: network
+  patch-file: patch.yaml
+`
+
+func TestReadKsniffConfig(t *testing.T) {
+	// given
+	dir, err := ioutil.TempDir("", "ksniff-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte(privilegedPodConfigFile), 0644))
+
+	// when
+	config, err := readKsniffConfig(filepath.Join(dir, "config.yaml"))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		config.PrivilegedPod.Tolerations)
+	assert.Equal(t, []string{"registry"}, config.PrivilegedPod.ImagePullSecrets)
+	assert.Equal(t, "system-node-critical", config.PrivilegedPod.PriorityClass)
+	assert.Equal(t, "1Gi", config.PrivilegedPod.Resources.Limits.Memory().String())
+	assert.Equal(t, map[string]string{"team": "network"}, config.PrivilegedPod.Labels)
+	assert.Equal(t, filepath.Join(dir, "patch.yaml"), config.PrivilegedPod.PatchFile)
+}
+
+func TestReadKsniffConfig_Missing(t *testing.T) {
+	// when
+	config, err := readKsniffConfig("/nonexistent/config.yaml")
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, config.PrivilegedPod.Tolerations)
+}
+
+func TestReadKsniffConfig_UnknownField(t *testing.T) {
+	// given
+	dir, err := ioutil.TempDir("", "ksniff-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte("privileged-pod:\n  toleration: []\n"), 0644))
+
+	// when
+	_, err = readKsniffConfig(filepath.Join(dir, "config.yaml"))
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestBuildPrivilegedPodOptions_FlagsOverrideConfig(t *testing.T) {
+	// given
+	defer viper.Reset()
+	viper.Set("pod-toleration", []string{"dedicated=infra:NoExecute"})
+	viper.Set("pod-memory-limit", "2Gi")
+	viper.Set("pod-cpu-request", "500m")
+	viper.Set("helper-namespace", "ksniff-system")
+	config := privilegedPodConfig{
+		Namespace:     "sniffing",
+		Tolerations:   []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}},
+		PriorityClass: "system-node-critical",
+	}
+
+	// when
+	options, err := buildPrivilegedPodOptions(config)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "infra",
+		Effect: corev1.TaintEffectNoExecute}}, options.Tolerations)
+	assert.Equal(t, "system-node-critical", options.PriorityClassName)
+	assert.Equal(t, "ksniff-system", options.Namespace)
+	assert.Equal(t, "2Gi", options.Resources.Limits.Memory().String())
+	assert.Equal(t, "500m", options.Resources.Requests.Cpu().String())
+}
+
+func TestBuildPrivilegedPodOptions_MissingPatchFile(t *testing.T) {
+	// given
+	defer viper.Reset()
+
+	// when
+	_, err := buildPrivilegedPodOptions(privilegedPodConfig{PatchFile: "/nonexistent/patch.yaml"})
+
+	// then
+	assert.NotNil(t, err)
+}
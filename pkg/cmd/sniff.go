@@ -14,6 +14,7 @@ import (
 
 	"ksniff/kube"
 	"ksniff/pkg/config"
+	"ksniff/pkg/ksniff"
 	"ksniff/pkg/service/sniffer"
 	"ksniff/pkg/service/sniffer/runtime"
 
@@ -22,8 +23,6 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	corev1 "k8s.io/api/core/v1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -41,19 +40,22 @@ var (
 
 const minimumNumberOfArguments = 1
 const tcpdumpBinaryName = "static-tcpdump"
-const tcpdumpRemotePath = "/tmp/static-tcpdump"
-
-var tcpdumpLocalBinaryPathLookupList []string
+const customBridgesFolder = "/.ksniff/bridges/"
+const configFile = "/.ksniff/config.yaml"
 
 type Ksniff struct {
 	configFlags      *genericclioptions.ConfigFlags
 	resultingContext *api.Context
-	clientset        *kubernetes.Clientset
+	clientset        kubernetes.Interface
 	restConfig       *rest.Config
 	rawConfig        api.Config
 	settings         *config.KsniffSettings
 	snifferService   sniffer.SnifferService
-	wireshark        *exec.Cmd
+	// Local paths searched in order for a static tcpdump binary
+	tcpdumpLookupPaths []string
+	wireshark          *exec.Cmd
+	// The pod is picked from a list when stdin is a terminal and no pod is given
+	streams genericclioptions.IOStreams
 }
 
 func NewKsniff(settings *config.KsniffSettings) *Ksniff {
@@ -61,23 +63,26 @@ func NewKsniff(settings *config.KsniffSettings) *Ksniff {
 }
 
 func NewCmdSniff(streams genericclioptions.IOStreams) *cobra.Command {
-	ksniffSettings := config.NewKsniffSettings(streams)
+	ksniffSettings := config.NewKsniffSettings()
 
-	ksniff := NewKsniff(ksniffSettings)
+	sniff := NewKsniff(ksniffSettings)
+	sniff.streams = streams
 
 	cmd := &cobra.Command{
-		Use:          "sniff pod [-n namespace] [-c container] [-f filter] [-o output-file] [-l local-tcpdump-path] [-r remote-tcpdump-path]",
+		Use:          "sniff [pod] [-n namespace] [-c container] [-f filter] [-o output-file] [-l local-tcpdump-path] [-r remote-tcpdump-path]",
 		Short:        "Perform network sniffing on a container running in a kubernetes cluster.",
 		Example:      ksniffExample,
 		SilenceUsage: true,
+		// Pod names aren't mistaken for unknown subcommands
+		Args: cobra.ArbitraryArgs,
 		RunE: func(c *cobra.Command, args []string) error {
-			if err := ksniff.Complete(c, args); err != nil {
+			if err := sniff.Complete(c, args); err != nil {
 				return err
 			}
-			if err := ksniff.Validate(); err != nil {
+			if err := sniff.Validate(c.Context()); err != nil {
 				return err
 			}
-			if err := ksniff.Run(); err != nil {
+			if err := sniff.Run(c.Context()); err != nil {
 				return err
 			}
 
@@ -85,17 +90,18 @@ func NewCmdSniff(streams genericclioptions.IOStreams) *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedNamespace, "namespace", "n", "", "namespace (optional)")
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedNamespace, "namespace", "n", "", "namespace (optional)")
 	_ = viper.BindEnv("namespace", "KUBECTL_PLUGINS_CURRENT_NAMESPACE")
-	_ = viper.BindPFlag("namespace", cmd.Flags().Lookup("namespace"))
+	_ = viper.BindPFlag("namespace", cmd.PersistentFlags().Lookup("namespace"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedInterface, "interface", "i", "any", "pod interface to packet capture (optional)")
+	cmd.Flags().StringSliceVarP(&ksniffSettings.UserSpecifiedInterfaces, "interface", "i", []string{"any"},
+		"pod interface to packet capture, repeat it to capture on several interfaces into a pcapng output (optional)")
 	_ = viper.BindEnv("interface", "KUBECTL_PLUGINS_LOCAL_FLAG_INTERFACE")
 	_ = viper.BindPFlag("interface", cmd.Flags().Lookup("interface"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedContainer, "container", "c", "", "container (optional)")
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedContainer, "container", "c", "", "container, init container or ephemeral container, the default container of the pod when omitted (optional)")
 	_ = viper.BindEnv("container", "KUBECTL_PLUGINS_LOCAL_FLAG_CONTAINER")
-	_ = viper.BindPFlag("container", cmd.Flags().Lookup("container"))
+	_ = viper.BindPFlag("container", cmd.PersistentFlags().Lookup("container"))
 
 	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedFilter, "filter", "f", "", "tcpdump filter (optional)")
 	_ = viper.BindEnv("filter", "KUBECTL_PLUGINS_LOCAL_FLAG_FILTER")
@@ -106,79 +112,167 @@ func NewCmdSniff(streams genericclioptions.IOStreams) *cobra.Command {
 	_ = viper.BindEnv("output-file", "KUBECTL_PLUGINS_LOCAL_FLAG_OUTPUT_FILE")
 	_ = viper.BindPFlag("output-file", cmd.Flags().Lookup("output-file"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedLocalTcpdumpPath, "local-tcpdump-path", "l", "",
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedLocalTcpdumpPath, "local-tcpdump-path", "l", "",
 		"local static tcpdump binary path (optional)")
 	_ = viper.BindEnv("local-tcpdump-path", "KUBECTL_PLUGINS_LOCAL_FLAG_LOCAL_TCPDUMP_PATH")
-	_ = viper.BindPFlag("local-tcpdump-path", cmd.Flags().Lookup("local-tcpdump-path"))
+	_ = viper.BindPFlag("local-tcpdump-path", cmd.PersistentFlags().Lookup("local-tcpdump-path"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedRemoteTcpdumpPath, "remote-tcpdump-path", "r", tcpdumpRemotePath,
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedRemoteTcpdumpPath, "remote-tcpdump-path", "r", ksniff.DefaultRemoteTcpdumpPath,
 		"remote static tcpdump binary path (optional)")
 	_ = viper.BindEnv("remote-tcpdump-path", "KUBECTL_PLUGINS_LOCAL_FLAG_REMOTE_TCPDUMP_PATH")
-	_ = viper.BindPFlag("remote-tcpdump-path", cmd.Flags().Lookup("remote-tcpdump-path"))
+	_ = viper.BindPFlag("remote-tcpdump-path", cmd.PersistentFlags().Lookup("remote-tcpdump-path"))
 
-	cmd.Flags().BoolVarP(&ksniffSettings.UserSpecifiedVerboseMode, "verbose", "v", false,
+	cmd.PersistentFlags().BoolVarP(&ksniffSettings.UserSpecifiedVerboseMode, "verbose", "v", false,
 		"if specified, ksniff output will include debug information (optional)")
 	_ = viper.BindEnv("verbose", "KUBECTL_PLUGINS_LOCAL_FLAG_VERBOSE")
-	_ = viper.BindPFlag("verbose", cmd.Flags().Lookup("verbose"))
+	_ = viper.BindPFlag("verbose", cmd.PersistentFlags().Lookup("verbose"))
 
-	cmd.Flags().BoolVarP(&ksniffSettings.UserSpecifiedPrivilegedMode, "privileged", "p", false,
+	cmd.PersistentFlags().BoolVarP(&ksniffSettings.UserSpecifiedPrivilegedMode, "privileged", "p", false,
 		"if specified, ksniff will deploy another pod that have privileges to attach target pod network namespace")
 	_ = viper.BindEnv("privileged", "KUBECTL_PLUGINS_LOCAL_FLAG_PRIVILEGED")
-	_ = viper.BindPFlag("privileged", cmd.Flags().Lookup("privileged"))
-
-	cmd.Flags().DurationVarP(&ksniffSettings.UserSpecifiedPodCreateTimeout, "pod-creation-timeout", "",
+	_ = viper.BindPFlag("privileged", cmd.PersistentFlags().Lookup("privileged"))
+
+	cmd.PersistentFlags().BoolVarP(&ksniffSettings.UserSpecifiedHostVethMode, "host-veth", "", false,
+		"if specified, ksniff will deploy a host network pod that captures on the host side of the target pod veth, "+
+			"for nodes where the pod network namespace can't be entered")
+	_ = viper.BindEnv("host-veth", "KUBECTL_PLUGINS_LOCAL_FLAG_HOST_VETH")
+	_ = viper.BindPFlag("host-veth", cmd.PersistentFlags().Lookup("host-veth"))
+
+	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedCompression, "compress", "", sniffer.CompressionNone,
+		fmt.Sprintf("compress the capture stream in transit, one of: %v (optional)", sniffer.SupportedCompressions))
+	_ = viper.BindEnv("compress", "KUBECTL_PLUGINS_LOCAL_FLAG_COMPRESS")
+	_ = viper.BindPFlag("compress", cmd.Flags().Lookup("compress"))
+
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedExecTransport, "exec-transport", "", kube.ExecTransportAuto,
+		fmt.Sprintf("streaming protocol used to execute commands in pods, one of: %v (optional)", kube.SupportedExecTransports))
+	_ = viper.BindEnv("exec-transport", "KUBECTL_PLUGINS_LOCAL_FLAG_EXEC_TRANSPORT")
+	_ = viper.BindPFlag("exec-transport", cmd.PersistentFlags().Lookup("exec-transport"))
+
+	cmd.Flags().IntVarP(&ksniffSettings.UserSpecifiedMaxReconnects, "max-reconnects", "", 0,
+		"reconnect a lost capture stream up to this many consecutive times, the output is pcapng when enabled (optional)")
+	_ = viper.BindEnv("max-reconnects", "KUBECTL_PLUGINS_LOCAL_FLAG_MAX_RECONNECTS")
+	_ = viper.BindPFlag("max-reconnects", cmd.Flags().Lookup("max-reconnects"))
+
+	cmd.Flags().BoolVarP(&ksniffSettings.UserSpecifiedDryRun, "dry-run", "", false,
+		"print the helper pod ksniff would create and its difference from a fully privileged pod, without creating anything (optional)")
+	_ = viper.BindEnv("dry-run", "KUBECTL_PLUGINS_LOCAL_FLAG_DRY_RUN")
+	_ = viper.BindPFlag("dry-run", cmd.Flags().Lookup("dry-run"))
+
+	cmd.Flags().BoolVarP(&ksniffSettings.UserSpecifiedWholeNode, "whole-node", "", false,
+		"capture the traffic of the whole node for a host network pod, instead of the ports the pod listens on (optional)")
+	_ = viper.BindEnv("whole-node", "KUBECTL_PLUGINS_LOCAL_FLAG_WHOLE_NODE")
+	_ = viper.BindPFlag("whole-node", cmd.Flags().Lookup("whole-node"))
+
+	cmd.PersistentFlags().DurationVarP(&ksniffSettings.UserSpecifiedPodCreateTimeout, "pod-creation-timeout", "",
 		1*time.Minute, "the length of time to wait for privileged pod to be created (e.g. 20s, 2m, 1h). "+
 			"A value of zero means the creation never times out.")
 
-	cmd.Flags().StringVarP(&ksniffSettings.Image, "image", "", "",
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.Image, "image", "", "",
 		"the privileged container image (optional)")
 	_ = viper.BindEnv("image", "KUBECTL_PLUGINS_LOCAL_FLAG_IMAGE")
-	_ = viper.BindPFlag("image", cmd.Flags().Lookup("image"))
+	_ = viper.BindPFlag("image", cmd.PersistentFlags().Lookup("image"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.TCPDumpImage, "tcpdump-image", "", "",
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.TCPDumpImage, "tcpdump-image", "", "",
 		"the tcpdump container image (optional)")
 	_ = viper.BindEnv("tcpdump-image", "KUBECTL_PLUGINS_LOCAL_FLAG_TCPDUMP_IMAGE")
-	_ = viper.BindPFlag("tcpdump-image", cmd.Flags().Lookup("tcpdump-image"))
+	_ = viper.BindPFlag("tcpdump-image", cmd.PersistentFlags().Lookup("tcpdump-image"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedKubeContext, "context", "x", "",
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedKubeContext, "context", "x", "",
 		"kubectl context to work on (optional)")
 	_ = viper.BindEnv("context", "KUBECTL_PLUGINS_CURRENT_CONTEXT")
-	_ = viper.BindPFlag("context", cmd.Flags().Lookup("context"))
+	_ = viper.BindPFlag("context", cmd.PersistentFlags().Lookup("context"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.SocketPath, "socket", "", "",
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.SocketPath, "socket", "", "",
 		"the container runtime socket path (optional)")
 	_ = viper.BindEnv("socket", "KUBECTL_PLUGINS_SOCKET_PATH")
-	_ = viper.BindPFlag("socket", cmd.Flags().Lookup("socket"))
+	_ = viper.BindPFlag("socket", cmd.PersistentFlags().Lookup("socket"))
 
-	cmd.Flags().StringVarP(&ksniffSettings.UserSpecifiedServiceAccount, "serviceaccount", "s", "",
+	cmd.PersistentFlags().StringVarP(&ksniffSettings.UserSpecifiedServiceAccount, "serviceaccount", "s", "",
 		"the privileged container service account (optional)")
 	_ = viper.BindEnv("serviceaccount", "KUBECTL_PLUGINS_LOCAL_FLAG_SERVICE_ACCOUNT")
-	_ = viper.BindPFlag("serviceaccount", cmd.Flags().Lookup("serviceaccount"))
+	_ = viper.BindPFlag("serviceaccount", cmd.PersistentFlags().Lookup("serviceaccount"))
+
+	cmd.PersistentFlags().StringP("helper-namespace", "", "",
+		"namespace of the privileged pod, the target pod namespace when not set (optional)")
+	_ = viper.BindEnv("helper-namespace", "KUBECTL_PLUGINS_LOCAL_FLAG_HELPER_NAMESPACE")
+	_ = viper.BindPFlag("helper-namespace", cmd.PersistentFlags().Lookup("helper-namespace"))
+
+	cmd.PersistentFlags().StringSliceP("pod-toleration", "", nil,
+		"toleration of the privileged pod as key[=value][:effect], every taint is tolerated when not set (optional)")
+	_ = viper.BindEnv("pod-toleration", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_TOLERATION")
+	_ = viper.BindPFlag("pod-toleration", cmd.PersistentFlags().Lookup("pod-toleration"))
+
+	cmd.PersistentFlags().StringToStringP("pod-node-selector", "", nil, "node selector of the privileged pod (optional)")
+	_ = viper.BindEnv("pod-node-selector", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_NODE_SELECTOR")
+	_ = viper.BindPFlag("pod-node-selector", cmd.PersistentFlags().Lookup("pod-node-selector"))
+
+	cmd.PersistentFlags().StringSliceP("image-pull-secret", "", nil, "image pull secret of the privileged pod (optional)")
+	_ = viper.BindEnv("image-pull-secret", "KUBECTL_PLUGINS_LOCAL_FLAG_IMAGE_PULL_SECRET")
+	_ = viper.BindPFlag("image-pull-secret", cmd.PersistentFlags().Lookup("image-pull-secret"))
+
+	cmd.PersistentFlags().StringP("pod-priority-class", "", "", "priority class of the privileged pod (optional)")
+	_ = viper.BindEnv("pod-priority-class", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_PRIORITY_CLASS")
+	_ = viper.BindPFlag("pod-priority-class", cmd.PersistentFlags().Lookup("pod-priority-class"))
+
+	for _, flag := range privilegedPodResourceFlags {
+		cmd.PersistentFlags().StringP(flag.name, "", "", fmt.Sprintf("%s %s of the privileged pod, e.g. %s (optional)",
+			flag.resource, flag.kind, flag.example))
+		_ = viper.BindEnv(flag.name, flag.env)
+		_ = viper.BindPFlag(flag.name, cmd.PersistentFlags().Lookup(flag.name))
+	}
+
+	cmd.PersistentFlags().StringToStringP("pod-label", "", nil, "extra label of the privileged pod (optional)")
+	_ = viper.BindEnv("pod-label", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_LABEL")
+	_ = viper.BindPFlag("pod-label", cmd.PersistentFlags().Lookup("pod-label"))
+
+	cmd.PersistentFlags().StringToStringP("pod-annotation", "", nil, "extra annotation of the privileged pod (optional)")
+	_ = viper.BindEnv("pod-annotation", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_ANNOTATION")
+	_ = viper.BindPFlag("pod-annotation", cmd.PersistentFlags().Lookup("pod-annotation"))
+
+	cmd.PersistentFlags().StringP("pod-patch", "", "",
+		"strategic merge patch file, YAML or JSON, applied to the generated privileged pod (optional)")
+	_ = viper.BindEnv("pod-patch", "KUBECTL_PLUGINS_LOCAL_FLAG_POD_PATCH")
+	_ = viper.BindPFlag("pod-patch", cmd.PersistentFlags().Lookup("pod-patch"))
+
+	sniff.registerCompletions(cmd)
+	cmd.AddCommand(NewCmdCompletion(streams))
+	cmd.AddCommand(NewCmdInterfaces(sniff))
 
 	return cmd
 }
 
 func (o *Ksniff) Complete(cmd *cobra.Command, args []string) error {
 
-	if len(args) < minimumNumberOfArguments {
+	interactive := len(args) < minimumNumberOfArguments && o.isInteractive()
+
+	if len(args) < minimumNumberOfArguments && !interactive {
 		_ = cmd.Usage()
 		return errors.New("not enough arguments")
 	}
 
-	o.settings.UserSpecifiedPodName = args[0]
-	if o.settings.UserSpecifiedPodName == "" {
-		return errors.New("pod name is empty")
+	if !interactive {
+		o.settings.UserSpecifiedPodName = args[0]
+		if o.settings.UserSpecifiedPodName == "" {
+			return errors.New("pod name is empty")
+		}
 	}
 
 	o.settings.UserSpecifiedNamespace = viper.GetString("namespace")
 	o.settings.UserSpecifiedContainer = viper.GetString("container")
-	o.settings.UserSpecifiedInterface = viper.GetString("interface")
+	o.settings.UserSpecifiedInterfaces = splitInterfaces(viper.GetStringSlice("interface"))
+	o.settings.UserSpecifiedInterface = o.settings.UserSpecifiedInterfaces[0]
 	o.settings.UserSpecifiedFilter = viper.GetString("filter")
 	o.settings.UserSpecifiedOutputFile = viper.GetString("output-file")
 	o.settings.UserSpecifiedLocalTcpdumpPath = viper.GetString("local-tcpdump-path")
 	o.settings.UserSpecifiedRemoteTcpdumpPath = viper.GetString("remote-tcpdump-path")
 	o.settings.UserSpecifiedVerboseMode = viper.GetBool("verbose")
 	o.settings.UserSpecifiedPrivilegedMode = viper.GetBool("privileged")
+	o.settings.UserSpecifiedHostVethMode = viper.GetBool("host-veth")
+	o.settings.UserSpecifiedCompression = viper.GetString("compress")
+	o.settings.UserSpecifiedExecTransport = viper.GetString("exec-transport")
+	o.settings.UserSpecifiedMaxReconnects = viper.GetInt("max-reconnects")
+	o.settings.UserSpecifiedDryRun = viper.GetBool("dry-run")
+	o.settings.UserSpecifiedWholeNode = viper.GetBool("whole-node")
 	o.settings.UserSpecifiedKubeContext = viper.GetString("context")
 	o.settings.Image = viper.GetString("image")
 	o.settings.TCPDumpImage = viper.GetString("tcpdump-image")
@@ -186,7 +280,9 @@ func (o *Ksniff) Complete(cmd *cobra.Command, args []string) error {
 	o.settings.UseDefaultImage = !viper.IsSet("image")
 	o.settings.UseDefaultTCPDumpImage = !viper.IsSet("tcpdump-image")
 	o.settings.UseDefaultSocketPath = !viper.IsSet("socket")
+	o.settings.UseDefaultRemoteTcpdumpPath = !viper.IsSet("remote-tcpdump-path")
 	o.settings.UserSpecifiedServiceAccount = viper.GetString("serviceaccount")
+	o.settings.UploadProgress = o.streams.ErrOut
 
 	var err error
 
@@ -195,11 +291,52 @@ func (o *Ksniff) Complete(cmd *cobra.Command, args []string) error {
 		log.SetLevel(log.DebugLevel)
 	}
 
-	tcpdumpLocalBinaryPathLookupList, err = o.buildTcpdumpBinaryPathLookupList()
+	o.tcpdumpLookupPaths, err = o.buildTcpdumpBinaryPathLookupList()
 	if err != nil {
 		return err
 	}
 
+	if err = o.loadCustomBridges(); err != nil {
+		return err
+	}
+
+	if err = o.loadPrivilegedPodOptions(); err != nil {
+		return err
+	}
+
+	if err = o.buildClients(); err != nil {
+		return err
+	}
+
+	if interactive {
+		return o.pickTarget(cmd.Context())
+	}
+
+	return nil
+}
+
+// splitInterfaces accepts comma separated interfaces as well, as the environment variable holds a single string
+func splitInterfaces(values []string) []string {
+	var interfaces []string
+	for _, value := range values {
+		for _, netInterface := range strings.Split(value, ",") {
+			if netInterface = strings.TrimSpace(netInterface); netInterface != "" {
+				interfaces = append(interfaces, netInterface)
+			}
+		}
+	}
+
+	if len(interfaces) == 0 {
+		return []string{"any"}
+	}
+
+	return interfaces
+}
+
+// buildClients connects to the cluster of the kube context and namespace set by the user
+func (o *Ksniff) buildClients() error {
+	var err error
+
 	o.rawConfig, err = o.configFlags.ToRawKubeConfigLoader().RawConfig()
 	if err != nil {
 		return err
@@ -263,125 +400,50 @@ func (o *Ksniff) buildTcpdumpBinaryPathLookupList() ([]string, error) {
 		filepath.Join("/usr/local/bin/", tcpdumpBinaryName), kubeKsniffPluginFolder), nil
 }
 
-func (o *Ksniff) Validate() error {
-	if len(o.rawConfig.CurrentContext) == 0 {
-		return errors.New("context doesn't exist")
-	}
-
-	if o.resultingContext.Namespace == "" {
-		return errors.New("namespace value is empty should be custom or default")
-	}
-
-	var err error
-
-	if !o.settings.UserSpecifiedPrivilegedMode {
-		o.settings.UserSpecifiedLocalTcpdumpPath, err = findLocalTcpdumpBinaryPath()
-		if err != nil {
-			return err
-		}
-
-		log.Infof("using tcpdump path at: '%s'", o.settings.UserSpecifiedLocalTcpdumpPath)
-	} else if o.settings.UserSpecifiedServiceAccount != "" {
-		_, err := o.clientset.CoreV1().ServiceAccounts(o.resultingContext.Namespace).Get(context.TODO(), o.settings.UserSpecifiedServiceAccount, v1.GetOptions{})
-		if err != nil {
-			return err
-		}
-	}
-
-	pod, err := o.clientset.CoreV1().Pods(o.resultingContext.Namespace).Get(context.TODO(), o.settings.UserSpecifiedPodName, v1.GetOptions{})
+func (o *Ksniff) loadCustomBridges() error {
+	userHomeDir, err := homedir.Dir()
 	if err != nil {
 		return err
 	}
 
-	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
-		return errors.Errorf("cannot sniff on a container in a completed pod; current phase is %s", pod.Status.Phase)
-	}
-
-	o.settings.DetectedPodNodeName = pod.Spec.NodeName
-
-	log.Debugf("pod '%s' status: '%s'", o.settings.UserSpecifiedPodName, pod.Status.Phase)
-
-	if len(pod.Spec.Containers) < 1 {
-		return errors.New("no containers in specified pod")
-	}
-
-	if o.settings.UserSpecifiedContainer == "" {
-		log.Info("no container specified, taking first container we found in pod.")
-		o.settings.UserSpecifiedContainer = pod.Spec.Containers[0].Name
-		log.Infof("selected container: '%s'", o.settings.UserSpecifiedContainer)
-	}
-
-	if err := o.findContainerId(pod); err != nil {
-		return err
-	}
-
-	kubernetesApiService := kube.NewKubernetesApiService(o.clientset, o.restConfig, o.resultingContext.Namespace)
-
-	if o.settings.UserSpecifiedPrivilegedMode {
-		log.Info("sniffing method: privileged pod")
-		bridge := runtime.NewContainerRuntimeBridge(o.settings.DetectedContainerRuntime)
-		o.snifferService = sniffer.NewPrivilegedPodRemoteSniffingService(o.settings, kubernetesApiService, bridge)
-	} else {
-		log.Info("sniffing method: upload static tcpdump")
-		o.snifferService = sniffer.NewUploadTcpdumpRemoteSniffingService(o.settings, kubernetesApiService)
-	}
-
-	return nil
+	return runtime.LoadCustomBridges(filepath.Join(userHomeDir, filepath.FromSlash(customBridgesFolder)))
 }
 
-func (o *Ksniff) findContainerId(pod *corev1.Pod) error {
-	for _, containerStatus := range pod.Status.ContainerStatuses {
-		if o.settings.UserSpecifiedContainer == containerStatus.Name {
-			result := strings.Split(containerStatus.ContainerID, "://")
-			if len(result) != 2 {
-				break
-			}
-			o.settings.DetectedContainerRuntime = result[0]
-			o.settings.DetectedContainerId = result[1]
-			return nil
-		}
+func (o *Ksniff) Validate(ctx context.Context) error {
+	if len(o.rawConfig.CurrentContext) == 0 {
+		return errors.New("context doesn't exist")
 	}
 
-	return errors.Errorf("couldn't find container: '%s' in pod: '%s'", o.settings.UserSpecifiedContainer, o.settings.UserSpecifiedPodName)
-}
-
-func findLocalTcpdumpBinaryPath() (string, error) {
-	log.Debugf("searching for tcpdump binary using lookup list: '%v'", tcpdumpLocalBinaryPathLookupList)
-
-	for _, possibleTcpdumpPath := range tcpdumpLocalBinaryPathLookupList {
-		if _, err := os.Stat(possibleTcpdumpPath); err == nil {
-			log.Debugf("tcpdump binary found at: '%s'", possibleTcpdumpPath)
-
-			return possibleTcpdumpPath, nil
-		}
+	var err error
 
-		log.Debugf("tcpdump binary was not found at: '%s'", possibleTcpdumpPath)
+	s := ksniff.NewSniffer(o.clientset, o.restConfig, o.resultingContext.Namespace, o.settings, o.tcpdumpLookupPaths)
+	if o.settings.UserSpecifiedDryRun {
+		s.DryRunOutput = os.Stdout
 	}
 
-	return "", errors.Errorf("couldn't find static tcpdump binary on any of: '%v'", tcpdumpLocalBinaryPathLookupList)
+	o.snifferService, err = s.NewSnifferService(ctx)
+
+	return err
 }
 
-func (o *Ksniff) setupSignalHandler() chan interface{} {
+// setupSignalHandler stops the capture and wireshark on interrupt, Run cleans up once they're stopped
+func (o *Ksniff) setupSignalHandler(cancel context.CancelFunc) chan interface{} {
 	signals := make(chan os.Signal, 1)
 	exit := make(chan interface{})
 
 	signal.Notify(signals, syscall.SIGINT)
 	go func() {
+		var received <-chan os.Signal = signals
 		for {
 			select {
-			case sig := <-signals:
+			case sig := <-received:
 				if sig == syscall.SIGINT || sig == syscall.SIGTERM {
-					log.Info("starting sniffer cleanup")
-					err := o.snifferService.Cleanup()
-					if err != nil {
-						log.WithError(err).Error("failed to teardown sniffer, a manual teardown is required.")
-					}
-					log.Info("sniffer cleanup completed successfully")
+					cancel()
 
 					// Kill wireshark if used
 					if o.wireshark != nil {
 						if o.wireshark.Process != nil {
-							err = o.wireshark.Process.Kill()
+							err := o.wireshark.Process.Kill()
 							if err != nil && err != os.ErrProcessDone {
 								log.WithError(err).Error("failed to kill wireshark process")
 							} else {
@@ -390,9 +452,11 @@ func (o *Ksniff) setupSignalHandler() chan interface{} {
 						}
 					}
 
-					close(signals)
+					// Further interrupts are ignored while Run cleans up, a nil channel never receives
+					received = nil
 				}
 			case <-exit:
+				signal.Stop(signals)
 				return
 			}
 
@@ -401,23 +465,36 @@ func (o *Ksniff) setupSignalHandler() chan interface{} {
 	return exit
 }
 
-func (o *Ksniff) Run() error {
-	log.Infof("sniffing on pod: '%s' [namespace: '%s', container: '%s', filter: '%s', interface: '%s']",
-		o.settings.UserSpecifiedPodName, o.resultingContext.Namespace, o.settings.UserSpecifiedContainer, o.settings.UserSpecifiedFilter, o.settings.UserSpecifiedInterface)
-
-	err := o.snifferService.Setup()
-	if err != nil {
-		return err
+func (o *Ksniff) Run(ctx context.Context) error {
+	if o.settings.UserSpecifiedDryRun {
+		return o.dryRun(ctx)
 	}
 
-	// Ensure sniffer is clean on interrupt
-	closeHandler := o.setupSignalHandler()
+	// Ensure sniffer is clean on every exit path, including an interrupt during the setup,
+	// once the capture was cancelled
+	defer o.cleanup()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Ensure sniffer is clean on complete
+	log.Infof("sniffing on pod: '%s' [namespace: '%s', container: '%s', filter: '%s', interface: '%s']",
+		o.settings.UserSpecifiedPodName, o.resultingContext.Namespace, o.settings.UserSpecifiedContainer, o.settings.UserSpecifiedFilter,
+		strings.Join(o.settings.UserSpecifiedInterfaces, ", "))
+
+	// Stop the capture on interrupt
+	closeHandler := o.setupSignalHandler(cancel)
 	defer func() {
 		closeHandler <- true
 	}()
 
+	err := o.snifferService.Setup(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
 	if o.settings.UserSpecifiedOutputFile != "" {
 		log.Infof("output file option specified, storing output in: '%s'", o.settings.UserSpecifiedOutputFile)
 
@@ -433,8 +510,8 @@ func (o *Ksniff) Run() error {
 			}
 		}
 
-		err = o.snifferService.Start(fileWriter)
-		if err != nil {
+		err = o.snifferService.Start(ctx, fileWriter)
+		if err != nil && ctx.Err() == nil {
 			return err
 		}
 
@@ -450,8 +527,8 @@ func (o *Ksniff) Run() error {
 		}
 
 		go func() {
-			err := o.snifferService.Start(stdinWriter)
-			if err != nil {
+			err := o.snifferService.Start(ctx, stdinWriter)
+			if err != nil && ctx.Err() == nil {
 				log.WithError(err).Errorf("failed to start remote sniffing, stopping wireshark")
 				_ = o.wireshark.Process.Kill()
 			}
@@ -463,3 +540,29 @@ func (o *Ksniff) Run() error {
 
 	return nil
 }
+
+// cleanup removes whatever the sniffer created, once the capture and the setup are over
+func (o *Ksniff) cleanup() {
+	log.Info("starting sniffer cleanup")
+
+	if err := o.snifferService.Cleanup(context.Background()); err != nil {
+		log.WithError(err).Error("failed to teardown sniffer, a manual teardown is required.")
+		return
+	}
+
+	log.Info("sniffer cleanup completed successfully")
+}
+
+// dryRun runs the setup up to the first change it would make on the cluster
+func (o *Ksniff) dryRun(ctx context.Context) error {
+	err := o.snifferService.Setup(ctx)
+	if cleanupErr := o.snifferService.Cleanup(context.Background()); cleanupErr != nil {
+		log.WithError(cleanupErr).Debug("dry run cleanup failed")
+	}
+
+	if err != nil && errors.Cause(err) != kube.ErrDryRun {
+		return err
+	}
+
+	return nil
+}
@@ -13,7 +13,7 @@ import (
 
 func TestComplete_NotEnoughArguments(t *testing.T) {
 	// given
-	settings := config.NewKsniffSettings(genericclioptions.IOStreams{})
+	settings := config.NewKsniffSettings()
 	sniff := NewKsniff(settings)
 	cmd := &cobra.Command{}
 	var commands []string
@@ -28,7 +28,7 @@ func TestComplete_NotEnoughArguments(t *testing.T) {
 
 func TestComplete_EmptyPodName(t *testing.T) {
 	// given
-	settings := config.NewKsniffSettings(genericclioptions.IOStreams{})
+	settings := config.NewKsniffSettings()
 	sniff := NewKsniff(settings)
 	cmd := &cobra.Command{}
 	var commands []string
@@ -43,7 +43,7 @@ func TestComplete_EmptyPodName(t *testing.T) {
 
 func TestComplete_PodNameSpecified(t *testing.T) {
 	// given
-	settings := config.NewKsniffSettings(genericclioptions.IOStreams{})
+	settings := config.NewKsniffSettings()
 	sniff := NewKsniff(settings)
 	cmd := NewCmdSniff(genericclioptions.IOStreams{})
 	var commands []string
@@ -55,3 +55,9 @@ func TestComplete_PodNameSpecified(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "pod-name", settings.UserSpecifiedPodName)
 }
+
+func TestSplitInterfaces(t *testing.T) {
+	assert.Equal(t, []string{"eth0", "net1"}, splitInterfaces([]string{"eth0", "net1"}))
+	assert.Equal(t, []string{"eth0", "net1", "wg0"}, splitInterfaces([]string{"eth0, net1", "wg0"}))
+	assert.Equal(t, []string{"any"}, splitInterfaces(nil))
+}
@@ -1,14 +1,17 @@
 package config
 
 import (
+	"io"
 	"time"
 
-	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"ksniff/kube"
 )
 
 type KsniffSettings struct {
-	UserSpecifiedPodName           string
-	UserSpecifiedInterface         string
+	UserSpecifiedPodName   string
+	UserSpecifiedInterface string
+	// Captured at once when there are several, UserSpecifiedInterface is the first of them
+	UserSpecifiedInterfaces        []string
 	UserSpecifiedFilter            string
 	UserSpecifiedPodCreateTimeout  time.Duration
 	UserSpecifiedContainer         string
@@ -18,10 +21,19 @@ type KsniffSettings struct {
 	UserSpecifiedRemoteTcpdumpPath string
 	UserSpecifiedVerboseMode       bool
 	UserSpecifiedPrivilegedMode    bool
+	UserSpecifiedHostVethMode      bool
+	UserSpecifiedCompression       string
+	UserSpecifiedExecTransport     string
+	UserSpecifiedMaxReconnects     int
+	UserSpecifiedDryRun            bool
+	UserSpecifiedWholeNode         bool
 	UserSpecifiedImage             string
 	DetectedPodNodeName            string
+	DetectedPodIP                  string
+	DetectedNodeArchitecture       string
 	DetectedContainerId            string
 	DetectedContainerRuntime       string
+	DetectedRuntimeHandler         string
 	Image                          string
 	TCPDumpImage                   string
 	UseDefaultImage                bool
@@ -29,9 +41,13 @@ type KsniffSettings struct {
 	UserSpecifiedKubeContext       string
 	SocketPath                     string
 	UseDefaultSocketPath           bool
+	UseDefaultRemoteTcpdumpPath    bool
 	UserSpecifiedServiceAccount    string
+	PrivilegedPodOptions           kube.PrivilegedPodOptions
+	// Receives the progress bar of the tcpdump upload when set
+	UploadProgress io.Writer
 }
 
-func NewKsniffSettings(streams genericclioptions.IOStreams) *KsniffSettings {
+func NewKsniffSettings() *KsniffSettings {
 	return &KsniffSettings{}
 }
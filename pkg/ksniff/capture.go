@@ -0,0 +1,275 @@
+package ksniff
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"ksniff/kube"
+	"ksniff/pkg/config"
+	"ksniff/pkg/service/sniffer"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Capture methods
+const (
+	// Upload a static tcpdump binary into the target container
+	MethodStatic = "static"
+	// Run tcpdump from a privileged pod in the network namespace of the target container
+	MethodPrivileged = "privileged"
+	// Run tcpdump from a host network pod on the host side of the target pod veth
+	MethodHostVeth = "host-veth"
+)
+
+const defaultPodCreateTimeout = time.Minute
+
+type Target struct {
+	// The default namespace when empty
+	Namespace string
+	Pod       string
+	// The container named by the kubectl.kubernetes.io/default-container annotation of the pod when empty,
+	// or else its first container
+	Container string
+}
+
+type Limits struct {
+	// Stop capturing after this long, no limit when 0
+	Duration time.Duration
+	// Stop capturing once this many bytes were read, no limit when 0.
+	// The output is cut at exactly this size, so its last packet may be truncated.
+	Bytes int64
+}
+
+// Capture describes a capture, zero values fall back to the defaults of the command line
+type Capture struct {
+	RestConfig *rest.Config
+	Target     Target
+	// One of the Method values, MethodStatic when empty
+	Method    string
+	Interface string
+	// Captured at once into a pcapng output when there are several, Interface is ignored when set
+	Interfaces []string
+	Filter     string
+	Limits     Limits
+	// Capture the whole node traffic of a host network pod instead of the ports it listens on
+	WholeNode bool
+
+	// Images of the privileged or host network pods, the runtime defaults when empty
+	Image        string
+	TCPDumpImage string
+	SocketPath   string
+	// Tolerations, resources and other customizations of those pods
+	PodOptions kube.PrivilegedPodOptions
+
+	ServiceAccount   string
+	PodCreateTimeout time.Duration
+	Compression      string
+	ExecTransport    string
+	MaxReconnects    int
+
+	// Static tcpdump binary to upload, searched on TcpdumpLookupPaths when empty
+	LocalTcpdumpPath   string
+	RemoteTcpdumpPath  string
+	TcpdumpLookupPaths []string
+}
+
+func (c *Capture) settings() (*config.KsniffSettings, error) {
+	settings := config.NewKsniffSettings()
+
+	settings.UserSpecifiedPodName = c.Target.Pod
+	settings.UserSpecifiedNamespace = c.Target.Namespace
+	settings.UserSpecifiedContainer = c.Target.Container
+	settings.UserSpecifiedFilter = c.Filter
+	settings.UserSpecifiedWholeNode = c.WholeNode
+	settings.UserSpecifiedPodCreateTimeout = c.PodCreateTimeout
+	settings.UserSpecifiedServiceAccount = c.ServiceAccount
+	settings.UserSpecifiedCompression = c.Compression
+	settings.UserSpecifiedExecTransport = c.ExecTransport
+	settings.UserSpecifiedMaxReconnects = c.MaxReconnects
+	settings.UserSpecifiedLocalTcpdumpPath = c.LocalTcpdumpPath
+	settings.UserSpecifiedRemoteTcpdumpPath = c.RemoteTcpdumpPath
+	settings.Image = c.Image
+	settings.TCPDumpImage = c.TCPDumpImage
+	settings.SocketPath = c.SocketPath
+	settings.PrivilegedPodOptions = c.PodOptions
+	settings.UseDefaultImage = c.Image == ""
+	settings.UseDefaultTCPDumpImage = c.TCPDumpImage == ""
+	settings.UseDefaultSocketPath = c.SocketPath == ""
+	settings.UseDefaultRemoteTcpdumpPath = c.RemoteTcpdumpPath == ""
+
+	switch c.Method {
+	case "", MethodStatic:
+	case MethodPrivileged:
+		settings.UserSpecifiedPrivilegedMode = true
+	case MethodHostVeth:
+		settings.UserSpecifiedHostVethMode = true
+	default:
+		return nil, errors.Errorf("unsupported capture method: '%s'", c.Method)
+	}
+
+	if c.RestConfig == nil {
+		return nil, errors.New("rest config is required")
+	}
+
+	if settings.UserSpecifiedPodName == "" {
+		return nil, errors.New("pod name is empty")
+	}
+
+	if settings.UserSpecifiedNamespace == "" {
+		settings.UserSpecifiedNamespace = "default"
+	}
+
+	if len(c.Interfaces) > 0 {
+		settings.UserSpecifiedInterfaces = c.Interfaces
+	} else if c.Interface != "" {
+		settings.UserSpecifiedInterfaces = []string{c.Interface}
+	} else {
+		settings.UserSpecifiedInterfaces = []string{"any"}
+	}
+	settings.UserSpecifiedInterface = settings.UserSpecifiedInterfaces[0]
+
+	if settings.UserSpecifiedPodCreateTimeout == 0 {
+		settings.UserSpecifiedPodCreateTimeout = defaultPodCreateTimeout
+	}
+
+	if settings.UserSpecifiedCompression == "" {
+		settings.UserSpecifiedCompression = sniffer.CompressionNone
+	}
+
+	if settings.UserSpecifiedExecTransport == "" {
+		settings.UserSpecifiedExecTransport = kube.ExecTransportAuto
+	}
+
+	if settings.UserSpecifiedRemoteTcpdumpPath == "" {
+		settings.UserSpecifiedRemoteTcpdumpPath = DefaultRemoteTcpdumpPath
+	}
+
+	if c.Limits.Duration < 0 || c.Limits.Bytes < 0 {
+		return nil, errors.New("capture limits must not be negative")
+	}
+
+	return settings, nil
+}
+
+// Run sets up the capture and returns its output, pcap (or pcapng when reconnecting or capturing
+// on several interfaces) as tcpdump writes it.
+// The capture runs until tcpdump exits, a limit is reached, the context is done or the reader is closed,
+// and is cleaned up before the reader returns EOF. Closing the reader waits for the cleanup.
+func Run(ctx context.Context, opts Capture) (io.ReadCloser, error) {
+	settings, err := opts.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(opts.RestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return run(ctx, clientset, opts, settings)
+}
+
+func run(ctx context.Context, clientset kubernetes.Interface, opts Capture, settings *config.KsniffSettings) (io.ReadCloser, error) {
+	snifferService, err := NewSniffer(clientset, opts.RestConfig, settings.UserSpecifiedNamespace,
+		settings, append([]string{settings.UserSpecifiedLocalTcpdumpPath}, opts.TcpdumpLookupPaths...)).NewSnifferService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	captureCtx, cancel := context.WithCancel(ctx)
+
+	if err := snifferService.Setup(captureCtx); err != nil {
+		cancel()
+		cleanup(snifferService)
+		return nil, err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	reader := &captureReader{PipeReader: pipeReader, cancel: cancel, done: make(chan struct{})}
+
+	var output io.Writer = pipeWriter
+	if opts.Limits.Bytes > 0 {
+		output = &limitedWriter{writer: pipeWriter, remaining: opts.Limits.Bytes, cancel: cancel}
+	}
+
+	go func() {
+		defer close(reader.done)
+
+		// The duration limit only counts the capture, not the creation of pods and the upload of the setup
+		startCtx := captureCtx
+		if opts.Limits.Duration > 0 {
+			var stopTimeout context.CancelFunc
+			startCtx, stopTimeout = context.WithTimeout(captureCtx, opts.Limits.Duration)
+			defer stopTimeout()
+		}
+
+		err := snifferService.Start(startCtx, output)
+		cancel()
+		cleanup(snifferService)
+
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if startCtx.Err() != nil {
+			// Stopped by a limit or by closing the reader
+			err = nil
+		}
+
+		_ = pipeWriter.CloseWithError(err)
+	}()
+
+	return reader, nil
+}
+
+func cleanup(snifferService sniffer.SnifferService) {
+	if err := snifferService.Cleanup(context.Background()); err != nil {
+		log.WithError(err).Error("failed to teardown sniffer, a manual teardown is required.")
+	}
+}
+
+type captureReader struct {
+	*io.PipeReader
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *captureReader) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		_ = c.PipeReader.Close()
+		<-c.done
+	})
+
+	return nil
+}
+
+// limitedWriter stops the capture once the given number of bytes was written
+type limitedWriter struct {
+	writer    io.Writer
+	remaining int64
+	cancel    context.CancelFunc
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, io.ErrShortWrite
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.writer.Write(p)
+	l.remaining -= int64(n)
+
+	if l.remaining <= 0 {
+		l.cancel()
+	}
+
+	return n, err
+}
@@ -0,0 +1,234 @@
+package ksniff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"ksniff/kube"
+	"ksniff/kube/fakeexec"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCaptureSettings_Defaults(t *testing.T) {
+	// given
+	capture := Capture{RestConfig: &rest.Config{}, Target: Target{Pod: "pod"}}
+
+	// when
+	settings, err := capture.settings()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "default", settings.UserSpecifiedNamespace)
+	assert.Equal(t, "any", settings.UserSpecifiedInterface)
+	assert.Equal(t, DefaultRemoteTcpdumpPath, settings.UserSpecifiedRemoteTcpdumpPath)
+	assert.Equal(t, defaultPodCreateTimeout, settings.UserSpecifiedPodCreateTimeout)
+	assert.True(t, settings.UseDefaultImage)
+	assert.True(t, settings.UseDefaultRemoteTcpdumpPath)
+	assert.False(t, settings.UserSpecifiedPrivilegedMode)
+	assert.False(t, settings.UserSpecifiedHostVethMode)
+}
+
+func TestCaptureSettings_Interfaces(t *testing.T) {
+	// given
+	capture := Capture{RestConfig: &rest.Config{}, Target: Target{Pod: "pod"}, Interface: "eth0", Interfaces: []string{"net1", "net2"}}
+
+	// when
+	settings, err := capture.settings()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"net1", "net2"}, settings.UserSpecifiedInterfaces)
+	assert.Equal(t, "net1", settings.UserSpecifiedInterface)
+}
+
+func TestCaptureSettings_Method(t *testing.T) {
+	// given
+	capture := Capture{RestConfig: &rest.Config{}, Target: Target{Pod: "pod"}, Method: MethodPrivileged, Image: "docker"}
+
+	// when
+	settings, err := capture.settings()
+
+	// then
+	assert.Nil(t, err)
+	assert.True(t, settings.UserSpecifiedPrivilegedMode)
+	assert.False(t, settings.UseDefaultImage)
+	assert.Equal(t, "docker", settings.Image)
+}
+
+func TestCaptureSettings_UnsupportedMethod(t *testing.T) {
+	// given
+	capture := Capture{RestConfig: &rest.Config{}, Target: Target{Pod: "pod"}, Method: "ebpf"}
+
+	// when
+	_, err := capture.settings()
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestCaptureSettings_MissingPod(t *testing.T) {
+	// given
+	capture := Capture{RestConfig: &rest.Config{}}
+
+	// when
+	_, err := capture.settings()
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestLimitedWriter(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := &limitedWriter{writer: &output, remaining: 5, cancel: cancel}
+
+	// when
+	n, err := writer.Write([]byte("abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	n, _ = writer.Write([]byte("defg"))
+
+	// then
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "abcde", output.String())
+	assert.NotNil(t, ctx.Err())
+}
+
+// newCaptureServer answers the tcpdump container of a privileged capture with packets until the client goes away
+func newCaptureServer(t *testing.T) (*fakeexec.Server, *fake.Clientset, func()) {
+	dir, err := ioutil.TempDir("", "ksniff")
+	assert.Nil(t, err)
+
+	server := fakeexec.NewServer(dir)
+	server.Handle("docker", func(cmd *fakeexec.Command) int {
+		if cmd.Args[3] != "run" {
+			return 0
+		}
+
+		for {
+			if _, err := cmd.StdOut.Write([]byte("packet")); err != nil {
+				return 0
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"), newNode("amd64", "docker://19.3.1"))
+
+	return server, clientset, func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func newCapture(server *fakeexec.Server) Capture {
+	return Capture{
+		RestConfig:       server.RestConfig(),
+		Target:           Target{Pod: "pod"},
+		Method:           MethodPrivileged,
+		PodCreateTimeout: time.Second,
+		ExecTransport:    kube.ExecTransportWebsocket,
+	}
+}
+
+func startCapture(ctx context.Context, t *testing.T, clientset kubernetes.Interface, opts Capture) io.ReadCloser {
+	settings, err := opts.settings()
+	assert.Nil(t, err)
+
+	reader, err := run(ctx, clientset, opts, settings)
+	assert.Nil(t, err)
+
+	return reader
+}
+
+func TestRun_BytesLimit(t *testing.T) {
+	// given
+	server, clientset, stop := newCaptureServer(t)
+	defer stop()
+	opts := newCapture(server)
+	opts.Limits.Bytes = 10
+
+	// when
+	reader := startCapture(context.Background(), t, server.Clientset(clientset), opts)
+	defer reader.Close()
+	output, err := ioutil.ReadAll(reader)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "packetpack", string(output))
+}
+
+func TestRun_DurationLimit(t *testing.T) {
+	// given
+	server, clientset, stop := newCaptureServer(t)
+	defer stop()
+	opts := newCapture(server)
+	opts.Limits.Duration = 100 * time.Millisecond
+
+	// when
+	reader := startCapture(context.Background(), t, server.Clientset(clientset), opts)
+	defer reader.Close()
+	output, err := ioutil.ReadAll(reader)
+
+	// then
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), "packet")
+}
+
+func TestRun_ContextCancelled(t *testing.T) {
+	// given
+	server, clientset, stop := newCaptureServer(t)
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := startCapture(ctx, t, server.Clientset(clientset), newCapture(server))
+	defer reader.Close()
+	_, err := io.ReadFull(reader, make([]byte, len("packet")))
+	assert.Nil(t, err)
+
+	// when
+	cancel()
+	_, err = ioutil.ReadAll(reader)
+
+	// then
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestRun_CloseWaitsForCleanup(t *testing.T) {
+	// given
+	server, clientset, stop := newCaptureServer(t)
+	defer stop()
+	deleted := false
+	clientset.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(100 * time.Millisecond)
+		deleted = true
+		return false, nil, nil
+	})
+	reader := startCapture(context.Background(), t, server.Clientset(clientset), newCapture(server))
+	_, err := io.ReadFull(reader, make([]byte, len("packet")))
+	assert.Nil(t, err)
+
+	// when
+	err = reader.Close()
+
+	// then
+	assert.Nil(t, err)
+	assert.True(t, deleted, "the privileged pod is deleted before Close returns")
+	pods, _ := clientset.CoreV1().Pods("default").List(context.Background(), v1.ListOptions{})
+	assert.Len(t, pods.Items, 1, "only the target pod is left")
+	commands := server.Commands()
+	assert.Contains(t, commands[len(commands)-1], "docker --host unix:///var/run/docker.sock rm -f")
+}
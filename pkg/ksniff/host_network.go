@@ -0,0 +1,162 @@
+package ksniff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ksniff/kube"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Prints the socket links of every process visible from the container, followed by the socket tables
+// of its network namespace, which is the node one for host network pods.
+const listSocketsScript = `
+for fd in /proc/[0-9]*/fd/*; do readlink "$fd"; done 2>/dev/null
+cat /proc/net/tcp /proc/net/tcp6 /proc/net/udp /proc/net/udp6 2>/dev/null
+true
+`
+
+// Socket states of /proc/net/tcp and /proc/net/udp meaning the socket waits for traffic
+const (
+	tcpListenState  = "0A"
+	udpUnboundState = "07"
+)
+
+// limitToPodPorts restricts the filter of a host network pod to the ports it listens on,
+// as capturing on its network namespace otherwise captures the traffic of the whole node.
+func (s *Sniffer) limitToPodPorts(ctx context.Context, pod *corev1.Pod, service kube.KubernetesApiService) error {
+	log.Warnf("pod: '%s' uses the host network, its network namespace carries the traffic of the whole node: '%s'",
+		s.settings.UserSpecifiedPodName, pod.Spec.NodeName)
+
+	if s.settings.UserSpecifiedWholeNode {
+		log.Warn("capturing the traffic of the whole node as requested")
+		return nil
+	}
+
+	ports := declaredPorts(pod)
+	if len(ports) == 0 {
+		log.Infof("pod: '%s' declares no container port, looking up the ports container: '%s' listens on",
+			s.settings.UserSpecifiedPodName, s.settings.UserSpecifiedContainer)
+
+		var err error
+		ports, err = s.findListeningPorts(ctx, service)
+		if err != nil {
+			return errors.Wrap(err, "failed to find the ports of the host network pod, use --whole-node to capture the whole node")
+		}
+	}
+
+	if len(ports) == 0 {
+		return errors.Errorf("pod: '%s' doesn't listen on any port, use --whole-node to capture the whole node",
+			s.settings.UserSpecifiedPodName)
+	}
+
+	s.settings.UserSpecifiedFilter = buildPortFilter(s.settings.UserSpecifiedFilter, ports)
+	log.Infof("limiting the capture to the ports of the pod, filter: '%s'", s.settings.UserSpecifiedFilter)
+
+	return nil
+}
+
+// declaredPorts returns the container ports of every container of the pod
+func declaredPorts(pod *corev1.Pod) []int {
+	unique := map[int]bool{}
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			unique[int(port.ContainerPort)] = true
+		}
+	}
+
+	return sortedPorts(unique)
+}
+
+func (s *Sniffer) findListeningPorts(ctx context.Context, service kube.KubernetesApiService) ([]int, error) {
+	var buff bytes.Buffer
+	command := []string{"/bin/sh", "-c", listSocketsScript}
+	exitCode, err := service.ExecuteCommand(ctx, s.settings.UserSpecifiedPodName, s.settings.UserSpecifiedContainer, command, &buff)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, errors.Errorf("listing sockets failed, exit code: '%d'", exitCode)
+	}
+
+	return parseListeningPorts(buff.String()), nil
+}
+
+// parseListeningPorts returns the local ports of the listening sockets owned by the listed socket links
+func parseListeningPorts(output string) []int {
+	inodes := map[string]bool{}
+	var sockets [][]string
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "socket:[") && strings.HasSuffix(line, "]") {
+			inodes[strings.TrimSuffix(strings.TrimPrefix(line, "socket:["), "]")] = true
+			continue
+		}
+
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(line)
+		if len(fields) >= 10 && strings.HasSuffix(fields[0], ":") {
+			sockets = append(sockets, fields)
+		}
+	}
+
+	unique := map[int]bool{}
+	for _, fields := range sockets {
+		state := fields[3]
+		if state != tcpListenState && state != udpUnboundState {
+			continue
+		}
+
+		if !inodes[fields[9]] {
+			continue
+		}
+
+		i := strings.LastIndex(fields[1], ":")
+		if i == -1 {
+			continue
+		}
+
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil || port == 0 {
+			continue
+		}
+
+		unique[int(port)] = true
+	}
+
+	return sortedPorts(unique)
+}
+
+func sortedPorts(unique map[int]bool) []int {
+	ports := make([]int, 0, len(unique))
+	for port := range unique {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	return ports
+}
+
+// buildPortFilter ANDs the user filter with a filter matching any of the given ports
+func buildPortFilter(filter string, ports []int) string {
+	portFilters := make([]string, 0, len(ports))
+	for _, port := range ports {
+		portFilters = append(portFilters, fmt.Sprintf("port %d", port))
+	}
+
+	portFilter := strings.Join(portFilters, " or ")
+	if filter == "" {
+		return portFilter
+	}
+
+	return fmt.Sprintf("(%s) and (%s)", filter, portFilter)
+}
@@ -0,0 +1,131 @@
+package ksniff
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"ksniff/kube"
+	"ksniff/kube/fakeexec"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The container owns the sockets 1001 (tcp 0.0.0.0:8080 listening), 1002 (tcp6 :::9090 listening)
+// and 1004 (established), the node owns 1003 (tcp 0.0.0.0:22 listening)
+const listSocketsOutput = `socket:[1001]
+socket:[1002]
+socket:[1004]
+pipe:[2001]
+/dev/null
+  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F90 0100007F:A2C4 01 00000000:00000000 00:00000000 00000000     0        0 1004 1 0000000000000000 20 4 30 10 -1
+  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:2382 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 100 0 0 10 0
+`
+
+func newHostNetworkPod(ports ...int32) *corev1.Pod {
+	pod := newPod("pod", corev1.PodRunning, "docker://abc")
+	pod.Spec.HostNetwork = true
+	for _, port := range ports {
+		pod.Spec.Containers[0].Ports = append(pod.Spec.Containers[0].Ports, corev1.ContainerPort{ContainerPort: port})
+	}
+	return pod
+}
+
+func TestParseListeningPorts(t *testing.T) {
+	// when
+	ports := parseListeningPorts(listSocketsOutput)
+
+	// then
+	assert.Equal(t, []int{8080, 9090}, ports)
+}
+
+func TestParseListeningPorts_Empty(t *testing.T) {
+	// when
+	ports := parseListeningPorts("")
+
+	// then
+	assert.Empty(t, ports)
+}
+
+func TestBuildPortFilter(t *testing.T) {
+	assert.Equal(t, "port 80", buildPortFilter("", []int{80}))
+	assert.Equal(t, "(tcp) and (port 80 or port 443)", buildPortFilter("tcp", []int{80, 443}))
+}
+
+func TestNewSnifferService_HostNetworkDeclaredPorts(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newHostNetworkPod(8080, 9090))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedFilter = "tcp"
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "(tcp) and (port 8080 or port 9090)", settings.UserSpecifiedFilter)
+}
+
+func TestNewSnifferService_HostNetworkListeningPorts(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newHostNetworkPod())
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	executor := &fakeexec.Executor{Handler: func(req kube.ExecCommandRequest) (int, error) {
+		_, err := io.WriteString(req.StdOut, listSocketsOutput)
+		return 0, err
+	}}
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+	s.Executor = executor
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "port 8080 or port 9090", settings.UserSpecifiedFilter)
+	assert.Len(t, executor.Commands(), 1)
+}
+
+func TestNewSnifferService_HostNetworkLookupFailed(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newHostNetworkPod())
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+	s.Executor = &fakeexec.Executor{Handler: func(req kube.ExecCommandRequest) (int, error) {
+		return 1, errors.New("no shell")
+	}}
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "--whole-node")
+}
+
+func TestNewSnifferService_HostNetworkWholeNode(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newHostNetworkPod(8080))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedFilter = "tcp"
+	settings.UserSpecifiedWholeNode = true
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp", settings.UserSpecifiedFilter)
+}
@@ -0,0 +1,405 @@
+package ksniff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"ksniff/kube"
+	"ksniff/pkg/config"
+	"ksniff/pkg/service/sniffer"
+	"ksniff/pkg/service/sniffer/runtime"
+	"ksniff/pkg/tcpdump"
+	"ksniff/utils"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const DefaultRemoteTcpdumpPath = "/tmp/static-tcpdump"
+const remoteTcpdumpPathChecksumLength = 16
+
+// https://kubernetes.io/docs/reference/labels-annotations-taints/#kubectl-kubernetes-io-default-container
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// Sniffer inspects the target pod and builds the sniffer service matching the settings
+type Sniffer struct {
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+	namespace  string
+	settings   *config.KsniffSettings
+
+	// Local paths searched in order for a static tcpdump binary, empty entries are skipped
+	TcpdumpLookupPaths []string
+
+	// Runs the commands in containers instead of the API server exec streams when set
+	Executor kube.CommandExecutor
+
+	// Prints the helper pods there instead of creating them when set, the setup then fails with kube.ErrDryRun
+	DryRunOutput io.Writer
+}
+
+func NewSniffer(clientset kubernetes.Interface, restConfig *rest.Config, namespace string,
+	settings *config.KsniffSettings, tcpdumpLookupPaths []string) *Sniffer {
+	return &Sniffer{clientset: clientset, restConfig: restConfig, namespace: namespace,
+		settings: settings, TcpdumpLookupPaths: tcpdumpLookupPaths}
+}
+
+func (s *Sniffer) validateSettings() error {
+	if s.namespace == "" {
+		return errors.New("namespace value is empty should be custom or default")
+	}
+
+	if err := s.settings.PrivilegedPodOptions.Validate(); err != nil {
+		return err
+	}
+
+	if !sniffer.IsSupportedCompression(s.settings.UserSpecifiedCompression) {
+		return errors.Errorf("unsupported compression: '%s', supported compressions are: %v",
+			s.settings.UserSpecifiedCompression, sniffer.SupportedCompressions)
+	}
+
+	if !kube.IsSupportedExecTransport(s.settings.UserSpecifiedExecTransport) {
+		return errors.Errorf("unsupported exec transport: '%s', supported transports are: %v",
+			s.settings.UserSpecifiedExecTransport, kube.SupportedExecTransports)
+	}
+
+	if s.settings.UserSpecifiedMaxReconnects < 0 {
+		return errors.Errorf("max reconnects must not be negative: '%d'", s.settings.UserSpecifiedMaxReconnects)
+	}
+
+	if len(s.settings.UserSpecifiedInterfaces) > 1 {
+		seen := map[string]bool{}
+		for _, netInterface := range s.settings.UserSpecifiedInterfaces {
+			if netInterface == "any" {
+				return errors.New("interface 'any' already captures every interface, it can't be combined with others")
+			}
+			if seen[netInterface] {
+				return errors.Errorf("interface: '%s' is given more than once", netInterface)
+			}
+			seen[netInterface] = true
+		}
+	}
+
+	return nil
+}
+
+// NewSnifferService fills the detected settings of the target pod and returns the service
+// capturing its traffic, using the method the settings ask for or the pod requires.
+func (s *Sniffer) NewSnifferService(ctx context.Context) (sniffer.SnifferService, error) {
+	pod, kubernetesApiService, err := s.inspectTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if pod.Spec.HostNetwork {
+		if err := s.limitToPodPorts(ctx, pod, kubernetesApiService); err != nil {
+			return nil, err
+		}
+	}
+
+	// Looking up the ports is read only, so it runs for real
+	if s.DryRunOutput != nil {
+		kubernetesApiService = kube.NewDryRunKubernetesApiService(s.clientset, s.namespace, s.DryRunOutput)
+	}
+
+	var snifferService sniffer.SnifferService
+
+	if s.settings.UserSpecifiedHostVethMode {
+		log.Info("sniffing method: host side veth")
+		snifferService = sniffer.NewHostVethSniffingService(s.settings, kubernetesApiService)
+	} else if s.settings.UserSpecifiedPrivilegedMode {
+		log.Info("sniffing method: privileged pod")
+
+		var bridge runtime.ContainerRuntimeBridge
+		if runtime.IsSandboxRuntimeHandler(s.settings.DetectedRuntimeHandler) {
+			bridge, err = runtime.NewSandboxRuntimeBridge(s.settings.DetectedRuntimeHandler)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			bridge = runtime.NewContainerRuntimeBridge(s.settings.DetectedContainerRuntime)
+		}
+		snifferService = sniffer.NewPrivilegedPodRemoteSniffingService(s.settings, kubernetesApiService, bridge)
+	} else {
+		log.Info("sniffing method: upload static tcpdump")
+		snifferService = sniffer.NewUploadTcpdumpRemoteSniffingService(s.settings, kubernetesApiService)
+	}
+
+	if len(s.settings.UserSpecifiedInterfaces) > 1 {
+		interfaceSnifferService, ok := snifferService.(sniffer.InterfaceSnifferService)
+		if !ok {
+			return nil, errors.New("the host side veth capture captures a single interface, several interfaces can't be given")
+		}
+
+		log.Infof("capturing on interfaces: '%s' into a pcapng output", strings.Join(s.settings.UserSpecifiedInterfaces, ", "))
+		snifferService = sniffer.NewMultiInterfaceSnifferService(interfaceSnifferService, s.settings.UserSpecifiedInterfaces,
+			s.settings.UserSpecifiedMaxReconnects)
+	} else if s.settings.UserSpecifiedMaxReconnects > 0 {
+		snifferService = sniffer.NewReconnectingSnifferService(snifferService, s.settings.UserSpecifiedMaxReconnects)
+	}
+
+	return snifferService, nil
+}
+
+// NewInterfacesService fills the detected settings of the target pod and returns the service
+// listing the interfaces of its network namespace.
+func (s *Sniffer) NewInterfacesService(ctx context.Context) (*sniffer.InterfacesService, error) {
+	pod, kubernetesApiService, err := s.inspectTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if pod.Spec.HostNetwork {
+		log.Warnf("pod: '%s' uses the host network, listing the interfaces of node: '%s'",
+			s.settings.UserSpecifiedPodName, pod.Spec.NodeName)
+	}
+
+	return sniffer.NewInterfacesService(s.settings, kubernetesApiService), nil
+}
+
+// inspectTarget fills the detected settings of the target pod and container,
+// and returns the pod with the service executing commands in it.
+func (s *Sniffer) inspectTarget(ctx context.Context) (*corev1.Pod, kube.KubernetesApiService, error) {
+	if err := s.validateSettings(); err != nil {
+		return nil, nil, err
+	}
+
+	pod, err := s.clientset.CoreV1().Pods(s.namespace).Get(ctx, s.settings.UserSpecifiedPodName, v1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil, nil, errors.Errorf("cannot sniff on a container in a completed pod; current phase is %s", pod.Status.Phase)
+	}
+
+	s.settings.DetectedPodNodeName = pod.Spec.NodeName
+	s.settings.DetectedPodIP = pod.Status.PodIP
+
+	if pod.Spec.RuntimeClassName != nil {
+		s.settings.DetectedRuntimeHandler, err = s.findRuntimeClassHandler(ctx, *pod.Spec.RuntimeClassName)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Debugf("pod '%s' runtime handler: '%s'", s.settings.UserSpecifiedPodName, s.settings.DetectedRuntimeHandler)
+	}
+
+	if runtime.RequiresHostSideCapture(s.settings.DetectedRuntimeHandler) && !s.settings.UserSpecifiedHostVethMode {
+		log.Infof("pod '%s' runs inside a '%s' sandbox VM, capturing on the host side of its veth",
+			s.settings.UserSpecifiedPodName, s.settings.DetectedRuntimeHandler)
+		s.settings.UserSpecifiedHostVethMode = true
+	}
+
+	// VM sandboxes were switched to the host side veth capture above, only gVisor can be entered with -p
+	isSandboxed := runtime.IsSandboxRuntimeHandler(s.settings.DetectedRuntimeHandler)
+	if isSandboxed && !s.settings.UserSpecifiedPrivilegedMode && !s.settings.UserSpecifiedHostVethMode {
+		return nil, nil, errors.Errorf("pod '%s' runs inside a '%s' sandbox, static tcpdump can't capture its traffic. "+
+			"please use the privileged mode (-p)", s.settings.UserSpecifiedPodName, s.settings.DetectedRuntimeHandler)
+	}
+
+	if s.settings.UserSpecifiedHostVethMode && s.settings.DetectedPodIP == "" {
+		return nil, nil, errors.Errorf("pod '%s' has no IP address yet, cannot locate its host side interface", s.settings.UserSpecifiedPodName)
+	}
+
+	if !s.settings.UserSpecifiedPrivilegedMode && !s.settings.UserSpecifiedHostVethMode {
+		s.settings.DetectedNodeArchitecture, err = s.findNodeArchitecture(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s.settings.UserSpecifiedLocalTcpdumpPath, err = s.findLocalTcpdumpBinaryPath(s.settings.DetectedNodeArchitecture)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Infof("using tcpdump path at: '%s'", s.settings.UserSpecifiedLocalTcpdumpPath)
+
+		if s.settings.UseDefaultRemoteTcpdumpPath {
+			// Content addressed, so a stale or truncated binary is never mistaken for this one
+			checksum, err := utils.FileSha256(s.settings.UserSpecifiedLocalTcpdumpPath)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			s.settings.UserSpecifiedRemoteTcpdumpPath = fmt.Sprintf("%s-%s", DefaultRemoteTcpdumpPath, checksum[:remoteTcpdumpPathChecksumLength])
+		}
+	} else if s.settings.UserSpecifiedServiceAccount != "" {
+		// The service account is the one of the privileged pod, which may live in the helper namespace
+		serviceAccountNamespace := s.namespace
+		if s.settings.PrivilegedPodOptions.Namespace != "" {
+			serviceAccountNamespace = s.settings.PrivilegedPodOptions.Namespace
+		}
+
+		_, err := s.clientset.CoreV1().ServiceAccounts(serviceAccountNamespace).Get(ctx, s.settings.UserSpecifiedServiceAccount, v1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	log.Debugf("pod '%s' status: '%s'", s.settings.UserSpecifiedPodName, pod.Status.Phase)
+
+	if len(pod.Spec.Containers) < 1 {
+		return nil, nil, errors.New("no containers in specified pod")
+	}
+
+	if s.settings.UserSpecifiedContainer == "" {
+		s.settings.UserSpecifiedContainer = DefaultContainer(pod)
+		log.Infof("selected container: '%s'", s.settings.UserSpecifiedContainer)
+	}
+
+	if err := s.findContainerId(pod); err != nil {
+		return nil, nil, err
+	}
+
+	kubernetesApiService := kube.NewKubernetesApiService(s.clientset, s.restConfig, s.namespace, s.settings.UserSpecifiedExecTransport,
+		s.settings.UploadProgress)
+	if s.Executor != nil {
+		kubernetesApiService = kube.NewKubernetesApiServiceWithExecutor(s.clientset, s.restConfig, s.namespace, s.Executor,
+			s.settings.UploadProgress)
+	}
+
+	return pod, kubernetesApiService, nil
+}
+
+func (s *Sniffer) findRuntimeClassHandler(ctx context.Context, runtimeClassName string) (string, error) {
+	runtimeClass, err := s.clientset.NodeV1().RuntimeClasses().Get(ctx, runtimeClassName, v1.GetOptions{})
+	if err == nil {
+		return runtimeClass.Handler, nil
+	}
+
+	// Clusters older than 1.20 only serve the beta API
+	runtimeClassBeta, betaErr := s.clientset.NodeV1beta1().RuntimeClasses().Get(ctx, runtimeClassName, v1.GetOptions{})
+	if betaErr != nil {
+		return "", errors.Wrapf(err, "failed to get runtime class: '%s'", runtimeClassName)
+	}
+
+	return runtimeClassBeta.Handler, nil
+}
+
+// DefaultContainer returns the container named by the kubectl default container annotation, the first one otherwise
+func DefaultContainer(pod *corev1.Pod) string {
+	if name, ok := pod.Annotations[defaultContainerAnnotation]; ok {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == name {
+				log.Infof("no container specified, taking the default container of the pod")
+				return name
+			}
+		}
+
+		log.Warnf("default container: '%s' of pod: '%s' doesn't exist", name, pod.Name)
+	}
+
+	log.Info("no container specified, taking first container we found in pod.")
+
+	return pod.Spec.Containers[0].Name
+}
+
+// findContainerId looks the container up among the containers, init containers (sidecars included)
+// and ephemeral containers of the pod
+func (s *Sniffer) findContainerId(pod *corev1.Pod) error {
+	statuses := map[string][]corev1.ContainerStatus{
+		"":          pod.Status.ContainerStatuses,
+		"init":      pod.Status.InitContainerStatuses,
+		"ephemeral": pod.Status.EphemeralContainerStatuses,
+	}
+
+	var validNames []string
+	for _, kind := range []string{"", "init", "ephemeral"} {
+		for _, containerStatus := range statuses[kind] {
+			if kind == "" {
+				validNames = append(validNames, containerStatus.Name)
+			} else {
+				validNames = append(validNames, fmt.Sprintf("%s (%s)", containerStatus.Name, kind))
+			}
+
+			if s.settings.UserSpecifiedContainer != containerStatus.Name {
+				continue
+			}
+
+			if containerStatus.State.Terminated != nil {
+				return errors.Errorf("container: '%s' in pod: '%s' has terminated", containerStatus.Name, s.settings.UserSpecifiedPodName)
+			}
+
+			result := strings.Split(containerStatus.ContainerID, "://")
+			if len(result) != 2 {
+				return errors.Errorf("container: '%s' in pod: '%s' hasn't started yet", containerStatus.Name, s.settings.UserSpecifiedPodName)
+			}
+
+			if kind != "" {
+				log.Infof("container: '%s' is an %s container", containerStatus.Name, kind)
+			}
+
+			s.settings.DetectedContainerRuntime = result[0]
+			s.settings.DetectedContainerId = result[1]
+			return nil
+		}
+	}
+
+	return errors.Errorf("couldn't find container: '%s' in pod: '%s', valid containers: %s",
+		s.settings.UserSpecifiedContainer, s.settings.UserSpecifiedPodName, strings.Join(validNames, ", "))
+}
+
+func (s *Sniffer) findNodeArchitecture(ctx context.Context) (string, error) {
+	node, err := s.clientset.CoreV1().Nodes().Get(ctx, s.settings.DetectedPodNodeName, v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	log.Debugf("node '%s' architecture: '%s'", node.Name, node.Status.NodeInfo.Architecture)
+
+	return node.Status.NodeInfo.Architecture, nil
+}
+
+func (s *Sniffer) findLocalTcpdumpBinaryPath(architecture string) (string, error) {
+	log.Debugf("searching for tcpdump binary using lookup list: '%v'", s.TcpdumpLookupPaths)
+
+	for _, possibleTcpdumpPath := range s.TcpdumpLookupPaths {
+		if possibleTcpdumpPath == "" {
+			continue
+		}
+
+		// Prefer the binary built for the node architecture, e.g. static-tcpdump-arm64
+		candidates := []string{possibleTcpdumpPath}
+		if architecture != "" {
+			candidates = []string{possibleTcpdumpPath + "-" + architecture, possibleTcpdumpPath}
+		}
+
+		for _, candidate := range candidates {
+			if _, err := os.Stat(candidate); err != nil {
+				log.Debugf("tcpdump binary was not found at: '%s'", candidate)
+				continue
+			}
+
+			if err := utils.VerifyElfArchitecture(candidate, architecture); err != nil {
+				log.WithError(err).Warnf("skipping tcpdump binary at: '%s'", candidate)
+				continue
+			}
+
+			log.Debugf("tcpdump binary found at: '%s'", candidate)
+
+			return candidate, nil
+		}
+	}
+
+	lookupErr := errors.Errorf("couldn't find static tcpdump binary for architecture '%s' on any of: '%v'",
+		architecture, s.TcpdumpLookupPaths)
+
+	// The lookup list overrides the binaries embedded in the plugin, which are the last resort
+	embeddedTcpdumpPath, err := tcpdump.ExtractEmbeddedBinary(architecture)
+	if err == tcpdump.ErrNotEmbedded {
+		return "", lookupErr
+	}
+	if err != nil {
+		return "", errors.Wrap(err, lookupErr.Error())
+	}
+
+	return embeddedTcpdumpPath, nil
+}
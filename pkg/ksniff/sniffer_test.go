@@ -0,0 +1,497 @@
+package ksniff
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ksniff/kube"
+	"ksniff/kube/fakeexec"
+	"ksniff/pkg/config"
+	"ksniff/pkg/service/sniffer"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newSettings(podName string) *config.KsniffSettings {
+	settings := config.NewKsniffSettings()
+	settings.UserSpecifiedPodName = podName
+	settings.UserSpecifiedInterface = "any"
+	settings.UserSpecifiedCompression = sniffer.CompressionNone
+	settings.UserSpecifiedExecTransport = kube.ExecTransportAuto
+	settings.UserSpecifiedRemoteTcpdumpPath = DefaultRemoteTcpdumpPath
+	settings.UserSpecifiedPodCreateTimeout = time.Second
+	settings.UseDefaultImage = true
+	settings.UseDefaultTCPDumpImage = true
+	settings.UseDefaultSocketPath = true
+	settings.UseDefaultRemoteTcpdumpPath = true
+	return settings
+}
+
+func newPod(name string, phase corev1.PodPhase, containerIds ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: "node"},
+		Status:     corev1.PodStatus{Phase: phase, PodIP: "10.0.0.1"},
+	}
+
+	for i, containerId := range containerIds {
+		containerName := []string{"app", "sidecar"}[i]
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: containerName})
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses,
+			corev1.ContainerStatus{Name: containerName, ContainerID: containerId})
+	}
+
+	return pod
+}
+
+func newNode(architecture string, containerRuntime string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: v1.ObjectMeta{Name: "node"},
+		Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+			Architecture:            architecture,
+			ContainerRuntimeVersion: containerRuntime,
+		}},
+	}
+}
+
+// newFakeClientset names created pods after their generate name and starts them right away
+func newFakeClientset(objects ...runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Name = pod.GenerateName + "fake"
+		pod.Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+
+	return clientset
+}
+
+func TestNewSnifferService_PodNotFound(t *testing.T) {
+	// given
+	s := NewSniffer(newFakeClientset(), nil, "default", newSettings("missing"), nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestNewSnifferService_CompletedPod(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodSucceeded, "docker://abc"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "completed pod")
+}
+
+func TestNewSnifferService_SelectsFirstContainer(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc", "containerd://def"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	service, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.IsType(t, &sniffer.PrivilegedPodSnifferService{}, service)
+	assert.Equal(t, "app", settings.UserSpecifiedContainer)
+	assert.Equal(t, "docker", settings.DetectedContainerRuntime)
+	assert.Equal(t, "abc", settings.DetectedContainerId)
+	assert.Equal(t, "node", settings.DetectedPodNodeName)
+}
+
+func TestNewSnifferService_SpecifiedContainer(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc", "containerd://def"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedContainer = "sidecar"
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "containerd", settings.DetectedContainerRuntime)
+	assert.Equal(t, "def", settings.DetectedContainerId)
+}
+
+func TestNewSnifferService_ContainerNotFound(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedContainer = "missing"
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "couldn't find container: 'missing'")
+}
+
+func TestNewSnifferService_KataUsesHostVeth(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "containerd://abc")
+	runtimeClassName := "kata"
+	pod.Spec.RuntimeClassName = &runtimeClassName
+	clientset := newFakeClientset(pod, &nodev1.RuntimeClass{ObjectMeta: v1.ObjectMeta{Name: "kata"}, Handler: "kata-qemu"})
+	s := NewSniffer(clientset, nil, "default", newSettings("pod"), nil)
+
+	// when
+	service, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.IsType(t, &sniffer.HostVethSnifferService{}, service)
+}
+
+func TestNewSnifferService_KataWithPrivilegedUsesHostVeth(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "containerd://abc")
+	runtimeClassName := "kata"
+	pod.Spec.RuntimeClassName = &runtimeClassName
+	clientset := newFakeClientset(pod, &nodev1.RuntimeClass{ObjectMeta: v1.ObjectMeta{Name: "kata"}, Handler: "kata-qemu"})
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	service, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.IsType(t, &sniffer.HostVethSnifferService{}, service)
+}
+
+func TestNewSnifferService_SandboxedStaticIsRejected(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "containerd://abc")
+	runtimeClassName := "gvisor"
+	pod.Spec.RuntimeClassName = &runtimeClassName
+	clientset := newFakeClientset(pod, &nodev1.RuntimeClass{ObjectMeta: v1.ObjectMeta{Name: "gvisor"}, Handler: "runsc"})
+	s := NewSniffer(clientset, nil, "default", newSettings("pod"), nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "sandbox")
+	assert.Contains(t, err.Error(), "(-p)")
+}
+
+func TestNewSnifferService_Static(t *testing.T) {
+	// given
+	dir, err := ioutil.TempDir("", "ksniff")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tcpdumpPath := filepath.Join(dir, "static-tcpdump")
+	assert.Nil(t, ioutil.WriteFile(tcpdumpPath, []byte("ksniff"), 0755))
+
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"), newNode("", "docker://19.3.1"))
+	settings := newSettings("pod")
+	s := NewSniffer(clientset, nil, "default", settings, []string{"", filepath.Join(dir, "missing"), tcpdumpPath})
+
+	// when
+	service, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.IsType(t, &sniffer.StaticTcpdumpSnifferService{}, service)
+	assert.Equal(t, tcpdumpPath, settings.UserSpecifiedLocalTcpdumpPath)
+	assert.Equal(t, "/tmp/static-tcpdump-05f6011df9fc9287", settings.UserSpecifiedRemoteTcpdumpPath)
+}
+
+func TestNewSnifferService_StaticWithoutBinary(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"), newNode("amd64", "docker://19.3.1"))
+	s := NewSniffer(clientset, nil, "default", newSettings("pod"), []string{"/nonexistent/static-tcpdump"})
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "couldn't find static tcpdump binary")
+}
+
+func TestNewSnifferService_Reconnecting(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedMaxReconnects = 3
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	service, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.IsType(t, &sniffer.ReconnectingSnifferService{}, service)
+}
+
+func TestNewSnifferService_SeveralInterfaces(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedInterfaces = []string{"eth0", "net1"}
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	service, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.IsType(t, &sniffer.ReconnectingSnifferService{}, service)
+}
+
+func TestNewSnifferService_InvalidInterfaces(t *testing.T) {
+	for _, interfaces := range [][]string{{"eth0", "any"}, {"eth0", "eth0"}} {
+		// given
+		clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"))
+		settings := newSettings("pod")
+		settings.UserSpecifiedPrivilegedMode = true
+		settings.UserSpecifiedInterfaces = interfaces
+		s := NewSniffer(clientset, nil, "default", settings, nil)
+
+		// when
+		_, err := s.NewSnifferService(context.Background())
+
+		// then
+		assert.NotNil(t, err, interfaces)
+	}
+}
+
+func TestNewSnifferService_SeveralInterfacesOnHostVeth(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedHostVethMode = true
+	settings.UserSpecifiedInterfaces = []string{"eth0", "net1"}
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "single interface")
+}
+
+func TestNewSnifferService_ServiceAccountInHelperNamespace(t *testing.T) {
+	// given
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: v1.ObjectMeta{Name: "sniffer", Namespace: "ksniff-system"}}
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "docker://abc"), serviceAccount)
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedServiceAccount = "sniffer"
+	settings.PrivilegedPodOptions.Namespace = "ksniff-system"
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestPrivilegedSniffer_CleanupAfterFailedSetup(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "cri-o://abc"), newNode("amd64", "cri-o://1.20.0"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	executor := &fakeexec.Executor{Handler: func(req kube.ExecCommandRequest) (int, error) {
+		return 1, errors.New("inspect failed")
+	}}
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+	s.Executor = executor
+	service, err := s.NewSnifferService(context.Background())
+	assert.Nil(t, err)
+
+	// when
+	setupErr := service.Setup(context.Background())
+	cleanupErr := service.Cleanup(context.Background())
+
+	// then
+	assert.NotNil(t, setupErr)
+	assert.Nil(t, cleanupErr)
+	assert.NotEmpty(t, executor.Commands())
+	pods, _ := clientset.CoreV1().Pods("default").List(context.Background(), v1.ListOptions{})
+	assert.Len(t, pods.Items, 1, "only the target pod is left")
+	assert.Equal(t, "pod", pods.Items[0].Name)
+}
+
+func TestPrivilegedSniffer_DryRun(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "cri-o://abc"), newNode("amd64", "cri-o://1.20.0"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	out := &bytes.Buffer{}
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+	s.DryRunOutput = out
+	service, err := s.NewSnifferService(context.Background())
+	assert.Nil(t, err)
+
+	// when
+	setupErr := service.Setup(context.Background())
+	cleanupErr := service.Cleanup(context.Background())
+
+	// then
+	assert.Equal(t, kube.ErrDryRun, errors.Cause(setupErr))
+	assert.Nil(t, cleanupErr)
+	assert.Contains(t, out.String(), "SYS_ADMIN")
+	pods, _ := clientset.CoreV1().Pods("default").List(context.Background(), v1.ListOptions{})
+	assert.Len(t, pods.Items, 1, "only the target pod exists")
+}
+
+func TestNewSnifferService_DefaultContainerAnnotation(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "docker://abc", "containerd://def")
+	pod.Annotations = map[string]string{"kubectl.kubernetes.io/default-container": "sidecar"}
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	s := NewSniffer(newFakeClientset(pod), nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "sidecar", settings.UserSpecifiedContainer)
+	assert.Equal(t, "def", settings.DetectedContainerId)
+}
+
+func TestNewSnifferService_MissingDefaultContainer(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "docker://abc")
+	pod.Annotations = map[string]string{"kubectl.kubernetes.io/default-container": "missing"}
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	s := NewSniffer(newFakeClientset(pod), nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "app", settings.UserSpecifiedContainer)
+}
+
+func TestNewSnifferService_InitAndEphemeralContainers(t *testing.T) {
+	for _, containerName := range []string{"proxy", "debugger"} {
+		// given
+		pod := newPod("pod", corev1.PodRunning, "docker://abc")
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{Name: "migrate", ContainerID: "docker://old", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+			{Name: "proxy", ContainerID: "docker://proxy"},
+		}
+		pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{{Name: "debugger", ContainerID: "docker://debugger"}}
+		settings := newSettings("pod")
+		settings.UserSpecifiedPrivilegedMode = true
+		settings.UserSpecifiedContainer = containerName
+		s := NewSniffer(newFakeClientset(pod), nil, "default", settings, nil)
+
+		// when
+		_, err := s.NewSnifferService(context.Background())
+
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, containerName, settings.DetectedContainerId)
+	}
+}
+
+func TestNewSnifferService_TerminatedInitContainer(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "docker://abc")
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+		{Name: "migrate", ContainerID: "docker://old", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+	}
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedContainer = "migrate"
+	s := NewSniffer(newFakeClientset(pod), nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "has terminated")
+}
+
+func TestNewSnifferService_ContainerNotFoundListsValidNames(t *testing.T) {
+	// given
+	pod := newPod("pod", corev1.PodRunning, "docker://abc", "docker://def")
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{Name: "proxy", ContainerID: "docker://proxy"}}
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{{Name: "debugger"}}
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	settings.UserSpecifiedContainer = "missing"
+	s := NewSniffer(newFakeClientset(pod), nil, "default", settings, nil)
+
+	// when
+	_, err := s.NewSnifferService(context.Background())
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "valid containers: app, sidecar, proxy (init), debugger (ephemeral)")
+}
+
+func TestNewInterfacesService_PrivilegedEntersNetworkNamespace(t *testing.T) {
+	// given
+	clientset := newFakeClientset(newPod("pod", corev1.PodRunning, "containerd://abc"), newNode("amd64", "containerd://1.4.0"))
+	settings := newSettings("pod")
+	settings.UserSpecifiedPrivilegedMode = true
+	executor := &fakeexec.Executor{Handler: func(req kube.ExecCommandRequest) (int, error) {
+		_, _ = req.StdOut.Write([]byte("2: net1@if3: <BROADCAST,UP> mtu 9000 state UP \\    link/ether 72:1c:3e:4f:a0:11\n"))
+		return 0, nil
+	}}
+	s := NewSniffer(clientset, nil, "default", settings, nil)
+	s.Executor = executor
+	service, err := s.NewInterfacesService(context.Background())
+	assert.Nil(t, err)
+
+	// when
+	interfaces, listErr := service.List(context.Background())
+	cleanupErr := service.Cleanup(context.Background())
+
+	// then
+	assert.Nil(t, listErr)
+	assert.Nil(t, cleanupErr)
+	assert.Equal(t, []sniffer.NetworkInterface{{Name: "net1", LinkType: "ether", MTU: 9000, State: "up"}}, interfaces)
+	assert.Len(t, executor.Commands(), 1)
+	assert.Contains(t, executor.Commands()[0], `grep -l "abc" /proc/[0-9]*/cgroup`)
+	pods, _ := clientset.CoreV1().Pods("default").List(context.Background(), v1.ListOptions{})
+	assert.Len(t, pods.Items, 1, "only the target pod is left")
+}
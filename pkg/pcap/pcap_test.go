@@ -0,0 +1,146 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildPcap(order binary.ByteOrder, magic uint32, packets ...[]byte) []byte {
+	var stream bytes.Buffer
+	_ = binary.Write(&stream, order, []uint32{magic, 0x00040002, 0, 0, 65535, 1})
+
+	for i, data := range packets {
+		_ = binary.Write(&stream, order, []uint32{1600000000 + uint32(i), 500, uint32(len(data)), uint32(len(data))})
+		stream.Write(data)
+	}
+
+	return stream.Bytes()
+}
+
+func TestReader_LittleEndian(t *testing.T) {
+	// given
+	stream := buildPcap(binary.LittleEndian, magicMicroseconds, []byte("packet"))
+
+	// when
+	reader, err := NewReader(bytes.NewReader(stream))
+	assert.Nil(t, err)
+	packet, err := reader.ReadPacket()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), reader.LinkType)
+	assert.Equal(t, uint32(65535), reader.SnapLength)
+	assert.Equal(t, []byte("packet"), packet.Data)
+	assert.Equal(t, time.Unix(1600000000, 500000), packet.Timestamp)
+
+	_, err = reader.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReader_BigEndianNanoseconds(t *testing.T) {
+	// given
+	stream := buildPcap(binary.BigEndian, magicNanoseconds, []byte("packet"))
+
+	// when
+	reader, err := NewReader(bytes.NewReader(stream))
+	assert.Nil(t, err)
+	packet, err := reader.ReadPacket()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1600000000, 500), packet.Timestamp)
+}
+
+func TestReader_TruncatedPacket(t *testing.T) {
+	// given
+	stream := buildPcap(binary.LittleEndian, magicMicroseconds, []byte("packet"))
+
+	// when
+	reader, err := NewReader(bytes.NewReader(stream[:len(stream)-2]))
+	assert.Nil(t, err)
+	_, err = reader.ReadPacket()
+
+	// then
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestReader_NotPcap(t *testing.T) {
+	// when
+	_, err := NewReader(bytes.NewReader(make([]byte, globalHeaderLength)))
+
+	// then
+	assert.NotNil(t, err)
+}
+
+// readBlocks splits a pcapng stream into its block types, checking both length fields match
+func readBlocks(t *testing.T, stream []byte) []uint32 {
+	var types []uint32
+
+	for len(stream) > 0 {
+		blockType := binary.LittleEndian.Uint32(stream[0:4])
+		length := binary.LittleEndian.Uint32(stream[4:8])
+		assert.Equal(t, uint32(0), length%4)
+		assert.Equal(t, length, binary.LittleEndian.Uint32(stream[length-4:length]))
+
+		types = append(types, blockType)
+		stream = stream[length:]
+	}
+
+	return types
+}
+
+func TestCopyToNg(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	writer, err := NewNgWriter(&output)
+	assert.Nil(t, err)
+
+	// when
+	first, err := CopyToNg(writer, bytes.NewReader(buildPcap(binary.LittleEndian, magicMicroseconds, []byte("a"), []byte("bb"))), "", "")
+	assert.Nil(t, err)
+	second, err := CopyToNg(writer, bytes.NewReader(buildPcap(binary.BigEndian, magicMicroseconds, []byte("ccc"))), "", "gap")
+	assert.Nil(t, err)
+
+	// then
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 1, second)
+	assert.Equal(t, []uint32{blockTypeSectionHeader, blockTypeInterfaceDescription,
+		blockTypeEnhancedPacket, blockTypeEnhancedPacket, blockTypeEnhancedPacket}, readBlocks(t, output.Bytes()))
+	assert.Contains(t, output.String(), "gap")
+}
+
+func TestCopyToNg_EmptyStream(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	writer, err := NewNgWriter(&output)
+	assert.Nil(t, err)
+
+	// when
+	packets, err := CopyToNg(writer, bytes.NewReader(nil), "", "")
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, packets)
+	assert.Equal(t, []uint32{blockTypeSectionHeader}, readBlocks(t, output.Bytes()))
+}
+
+func TestNgWriter_Interface(t *testing.T) {
+	// given
+	writer, err := NewNgWriter(&bytes.Buffer{})
+	assert.Nil(t, err)
+
+	// when
+	eth0, _ := writer.Interface(1, 65535, "eth0")
+	eth0Again, _ := writer.Interface(1, 65535, "eth0")
+	eth1, _ := writer.Interface(1, 65535, "eth1")
+
+	// then
+	assert.Equal(t, uint32(0), eth0)
+	assert.Equal(t, uint32(0), eth0Again)
+	assert.Equal(t, uint32(1), eth1)
+}
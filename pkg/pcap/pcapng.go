@@ -0,0 +1,174 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+const (
+	blockTypeSectionHeader        = 0x0a0d0d0a
+	blockTypeInterfaceDescription = 0x00000001
+	blockTypeEnhancedPacket       = 0x00000006
+	byteOrderMagic                = 0x1a2b3c4d
+)
+
+const (
+	optionEndOfOptions    = 0
+	optionComment         = 1
+	optionInterfaceName   = 2
+	optionUserApplication = 4
+	// Interface timestamp resolution, a single byte power of ten
+	optionTimestampResolution = 9
+)
+
+type interfaceKey struct {
+	linkType   uint32
+	snapLength uint32
+	name       string
+}
+
+// NgWriter writes a single section pcapng stream, timestamps are always in nanoseconds.
+// It's safe for concurrent use, so captures of several interfaces can be merged into one stream.
+type NgWriter struct {
+	mutex      sync.Mutex
+	writer     io.Writer
+	interfaces map[interfaceKey]uint32
+}
+
+// NewNgWriter writes the section header block to the given writer
+func NewNgWriter(writer io.Writer) (*NgWriter, error) {
+	w := &NgWriter{writer: writer, interfaces: make(map[interfaceKey]uint32)}
+
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.LittleEndian, uint32(byteOrderMagic))
+	_ = binary.Write(&body, binary.LittleEndian, uint16(1))
+	_ = binary.Write(&body, binary.LittleEndian, uint16(0))
+	// Section length isn't known while streaming
+	_ = binary.Write(&body, binary.LittleEndian, int64(-1))
+	writeOption(&body, optionUserApplication, []byte("ksniff"))
+	writeOption(&body, optionEndOfOptions, nil)
+
+	if err := w.writeBlock(blockTypeSectionHeader, body.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Interface returns the id of the interface matching the given link type, snap length and name,
+// describing it first when it wasn't seen before.
+func (w *NgWriter) Interface(linkType uint32, snapLength uint32, name string) (uint32, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	key := interfaceKey{linkType: linkType, snapLength: snapLength, name: name}
+	if id, ok := w.interfaces[key]; ok {
+		return id, nil
+	}
+
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.LittleEndian, uint16(linkType))
+	_ = binary.Write(&body, binary.LittleEndian, uint16(0))
+	_ = binary.Write(&body, binary.LittleEndian, snapLength)
+	if name != "" {
+		writeOption(&body, optionInterfaceName, []byte(name))
+	}
+	writeOption(&body, optionTimestampResolution, []byte{9})
+	writeOption(&body, optionEndOfOptions, nil)
+
+	if err := w.writeBlock(blockTypeInterfaceDescription, body.Bytes()); err != nil {
+		return 0, err
+	}
+
+	id := uint32(len(w.interfaces))
+	w.interfaces[key] = id
+
+	return id, nil
+}
+
+// WritePacket writes the packet captured on the given interface, with an optional comment
+func (w *NgWriter) WritePacket(interfaceId uint32, packet *Packet, comment string) error {
+	timestamp := uint64(packet.Timestamp.UnixNano())
+
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.LittleEndian, interfaceId)
+	_ = binary.Write(&body, binary.LittleEndian, uint32(timestamp>>32))
+	_ = binary.Write(&body, binary.LittleEndian, uint32(timestamp))
+	_ = binary.Write(&body, binary.LittleEndian, uint32(len(packet.Data)))
+	_ = binary.Write(&body, binary.LittleEndian, packet.OriginalLength)
+	body.Write(packet.Data)
+	body.Write(padding(len(packet.Data)))
+	if comment != "" {
+		writeOption(&body, optionComment, []byte(comment))
+		writeOption(&body, optionEndOfOptions, nil)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.writeBlock(blockTypeEnhancedPacket, body.Bytes())
+}
+
+func (w *NgWriter) writeBlock(blockType uint32, body []byte) error {
+	totalLength := uint32(len(body) + 12)
+
+	var block bytes.Buffer
+	_ = binary.Write(&block, binary.LittleEndian, blockType)
+	_ = binary.Write(&block, binary.LittleEndian, totalLength)
+	block.Write(body)
+	_ = binary.Write(&block, binary.LittleEndian, totalLength)
+
+	_, err := w.writer.Write(block.Bytes())
+	return err
+}
+
+func writeOption(body *bytes.Buffer, code uint16, value []byte) {
+	_ = binary.Write(body, binary.LittleEndian, code)
+	_ = binary.Write(body, binary.LittleEndian, uint16(len(value)))
+	body.Write(value)
+	body.Write(padding(len(value)))
+}
+
+// Blocks and option values are aligned to 32 bits
+func padding(length int) []byte {
+	return make([]byte, (4-length%4)%4)
+}
+
+// CopyToNg converts the pcap stream read from the given reader, attaching the comment to its first packet.
+// Returns the number of packets written, a stream ending in the middle of a packet isn't an error.
+func CopyToNg(writer *NgWriter, reader io.Reader, interfaceName string, firstPacketComment string) (int, error) {
+	pcapReader, err := NewReader(reader)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	interfaceId, err := writer.Interface(pcapReader.LinkType, pcapReader.SnapLength, interfaceName)
+	if err != nil {
+		return 0, err
+	}
+
+	packets := 0
+	comment := firstPacketComment
+
+	for {
+		packet, err := pcapReader.ReadPacket()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return packets, nil
+		}
+		if err != nil {
+			return packets, err
+		}
+
+		if err := writer.WritePacket(interfaceId, packet, comment); err != nil {
+			return packets, err
+		}
+
+		packets++
+		comment = ""
+	}
+}
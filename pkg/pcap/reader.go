@@ -0,0 +1,101 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+)
+
+const (
+	globalHeaderLength = 24
+	recordHeaderLength = 16
+)
+
+// Guards against allocating absurd buffers when the stream is corrupted
+const maxPacketLength = 256 * 1024
+
+type Packet struct {
+	Timestamp      time.Time
+	OriginalLength uint32
+	Data           []byte
+}
+
+// Reader reads packets from a classic pcap stream, as written by 'tcpdump -w -'
+type Reader struct {
+	reader      io.Reader
+	byteOrder   binary.ByteOrder
+	nanoseconds bool
+	LinkType    uint32
+	SnapLength  uint32
+}
+
+// NewReader reads the pcap global header, in either byte order and timestamp resolution
+func NewReader(reader io.Reader) (*Reader, error) {
+	header := make([]byte, globalHeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	r := &Reader{reader: reader}
+
+	switch {
+	case binary.LittleEndian.Uint32(header) == magicMicroseconds:
+		r.byteOrder = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == magicMicroseconds:
+		r.byteOrder = binary.BigEndian
+	case binary.LittleEndian.Uint32(header) == magicNanoseconds:
+		r.byteOrder, r.nanoseconds = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == magicNanoseconds:
+		r.byteOrder, r.nanoseconds = binary.BigEndian, true
+	default:
+		return nil, errors.Errorf("not a pcap stream, magic: '%x'", header[:4])
+	}
+
+	r.SnapLength = r.byteOrder.Uint32(header[16:20])
+	r.LinkType = r.byteOrder.Uint32(header[20:24])
+
+	return r, nil
+}
+
+// ReadPacket returns the next packet, io.EOF at the end of the stream
+// and io.ErrUnexpectedEOF when the stream ends in the middle of a packet.
+func (r *Reader) ReadPacket() (*Packet, error) {
+	header := make([]byte, recordHeaderLength)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return nil, err
+	}
+
+	seconds := r.byteOrder.Uint32(header[0:4])
+	fraction := r.byteOrder.Uint32(header[4:8])
+	capturedLength := r.byteOrder.Uint32(header[8:12])
+
+	if capturedLength > maxPacketLength {
+		return nil, errors.Errorf("invalid captured packet length: '%d'", capturedLength)
+	}
+
+	if !r.nanoseconds {
+		fraction *= 1000
+	}
+
+	packet := &Packet{
+		Timestamp:      time.Unix(int64(seconds), int64(fraction)),
+		OriginalLength: r.byteOrder.Uint32(header[12:16]),
+		Data:           make([]byte, capturedLength),
+	}
+
+	if _, err := io.ReadFull(r.reader, packet.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return packet, nil
+}
@@ -0,0 +1,231 @@
+package picker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrAborted is returned when the user leaves the picker without choosing
+var ErrAborted = errors.New("selection aborted")
+
+const defaultHeight = 10
+
+// Keys read from a terminal in raw mode
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Picker lets the user choose one of the items by typing part of it, the input is expected in raw mode
+type Picker struct {
+	in  *bufio.Reader
+	out io.Writer
+	// Items shown at once
+	Height int
+}
+
+func NewPicker(in io.Reader, out io.Writer) *Picker {
+	return &Picker{in: bufio.NewReader(in), out: out, Height: defaultHeight}
+}
+
+type match struct {
+	index int
+	score int
+}
+
+// Pick returns the index of the chosen item. The header is shown above the items, aligned with them.
+func (p *Picker) Pick(prompt string, header string, items []string) (int, error) {
+	if len(items) == 0 {
+		return -1, errors.New("nothing to choose from")
+	}
+
+	query := ""
+	selected := 0
+	drawnLines := 0
+
+	for {
+		matches := filter(query, items)
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+
+		drawnLines = p.render(drawnLines, prompt, query, header, items, matches, selected)
+
+		key, err := p.in.ReadByte()
+		if err == io.EOF {
+			p.clear(drawnLines)
+			return -1, ErrAborted
+		}
+		if err != nil {
+			return -1, err
+		}
+
+		switch key {
+		case keyCtrlC, keyCtrlD:
+			p.clear(drawnLines)
+			return -1, ErrAborted
+		case keyEnter, keyLineFeed:
+			if len(matches) == 0 {
+				continue
+			}
+			p.clear(drawnLines)
+			return matches[selected].index, nil
+		case keyBackspace, keyDelete:
+			if query != "" {
+				runes := []rune(query)
+				query = string(runes[:len(runes)-1])
+			}
+		case keyCtrlU:
+			query = ""
+		case keyCtrlP:
+			selected--
+		case keyCtrlN, keyTab:
+			selected++
+		case keyEscape:
+			// Only the arrow sequences are handled, telling a lone escape apart would need a timeout
+			if next, _ := p.in.ReadByte(); next != '[' && next != 'O' {
+				continue
+			}
+			switch arrow, _ := p.in.ReadByte(); arrow {
+			case 'A':
+				selected--
+			case 'B':
+				selected++
+			}
+		default:
+			if err := p.in.UnreadByte(); err != nil {
+				return -1, err
+			}
+			r, _, err := p.in.ReadRune()
+			if err != nil {
+				return -1, err
+			}
+			if unicode.IsPrint(r) {
+				query += string(r)
+				selected = 0
+			}
+		}
+	}
+}
+
+// render redraws the picker over the lines drawn last time and returns how many lines it drew
+func (p *Picker) render(drawnLines int, prompt string, query string, header string, items []string, matches []match, selected int) int {
+	var screen strings.Builder
+
+	p.moveUp(&screen, drawnLines)
+	screen.WriteString("\r\x1b[J")
+
+	fmt.Fprintf(&screen, "%s (%d/%d)\r\n", prompt, len(matches), len(items))
+	lines := 1
+
+	if header != "" {
+		fmt.Fprintf(&screen, "  %s\r\n", header)
+		lines++
+	}
+
+	// Keep the selected item in view
+	first := 0
+	if selected >= p.Height {
+		first = selected - p.Height + 1
+	}
+	for i := first; i < len(matches) && i < first+p.Height; i++ {
+		marker := "  "
+		if i == selected {
+			marker = "> "
+		}
+		fmt.Fprintf(&screen, "%s%s\r\n", marker, items[matches[i].index])
+		lines++
+	}
+
+	fmt.Fprintf(&screen, "> %s", query)
+
+	_, _ = io.WriteString(p.out, screen.String())
+
+	return lines
+}
+
+func (p *Picker) clear(drawnLines int) {
+	var screen strings.Builder
+	p.moveUp(&screen, drawnLines)
+	screen.WriteString("\r\x1b[J")
+	_, _ = io.WriteString(p.out, screen.String())
+}
+
+func (p *Picker) moveUp(screen *strings.Builder, lines int) {
+	if lines > 0 {
+		fmt.Fprintf(screen, "\x1b[%dA", lines)
+	}
+}
+
+// filter returns the items matching the query, best matches first and in their original order otherwise
+func filter(query string, items []string) []match {
+	var matches []match
+	for i, item := range items {
+		if score, ok := fuzzyScore(query, item); ok {
+			matches = append(matches, match{index: i, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	return matches
+}
+
+// fuzzyScore matches the query characters in order anywhere in the text, ignoring case and spaces.
+// Consecutive characters and characters starting a word score higher.
+func fuzzyScore(query string, text string) (int, bool) {
+	query = strings.ToLower(strings.Join(strings.Fields(query), ""))
+	textRunes := []rune(strings.ToLower(text))
+
+	score := 0
+	position := 0
+	previous := -2
+
+	for _, q := range query {
+		found := false
+		for ; position < len(textRunes); position++ {
+			if textRunes[position] != q {
+				continue
+			}
+
+			score++
+			if position == previous+1 {
+				score += 2
+			}
+			if position == 0 || !unicode.IsLetter(textRunes[position-1]) && !unicode.IsDigit(textRunes[position-1]) {
+				score++
+			}
+
+			previous = position
+			position++
+			found = true
+			break
+		}
+
+		if !found {
+			return 0, false
+		}
+	}
+
+	return score, true
+}
@@ -0,0 +1,121 @@
+package picker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pods = []string{
+	"frontend-7c77b68cff-qbvsd   Running",
+	"backend-5d4f8b9c6-x2k9p     Running",
+	"backend-worker-6f7d9-abcde  Running",
+}
+
+func TestPick_Enter(t *testing.T) {
+	// given
+	picker := NewPicker(strings.NewReader("\r"), &bytes.Buffer{})
+
+	// when
+	index, err := picker.Pick("pod", "NAME STATUS", pods)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, index)
+}
+
+func TestPick_Query(t *testing.T) {
+	// given
+	picker := NewPicker(strings.NewReader("bkwrk\r"), &bytes.Buffer{})
+
+	// when
+	index, err := picker.Pick("pod", "", pods)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 2, index)
+}
+
+func TestPick_Arrows(t *testing.T) {
+	// given
+	picker := NewPicker(strings.NewReader("\x1b[B\x1b[B\x1b[A\r"), &bytes.Buffer{})
+
+	// when
+	index, err := picker.Pick("pod", "", pods)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, index)
+}
+
+func TestPick_Backspace(t *testing.T) {
+	// given
+	picker := NewPicker(strings.NewReader("frontx\x7f\r"), &bytes.Buffer{})
+
+	// when
+	index, err := picker.Pick("pod", "", pods)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, index)
+}
+
+func TestPick_NoMatchIgnoresEnter(t *testing.T) {
+	// given
+	picker := NewPicker(strings.NewReader("zzz\r\x03"), &bytes.Buffer{})
+
+	// when
+	_, err := picker.Pick("pod", "", pods)
+
+	// then
+	assert.Equal(t, ErrAborted, err)
+}
+
+func TestPick_Aborted(t *testing.T) {
+	for _, input := range []string{"\x03", "\x04", "back"} {
+		// given
+		picker := NewPicker(strings.NewReader(input), &bytes.Buffer{})
+
+		// when
+		_, err := picker.Pick("pod", "", pods)
+
+		// then
+		assert.Equal(t, ErrAborted, err, input)
+	}
+}
+
+func TestPick_Render(t *testing.T) {
+	// given
+	out := &bytes.Buffer{}
+	picker := NewPicker(strings.NewReader("\r"), out)
+
+	// when
+	_, err := picker.Pick("pod", "NAME STATUS", pods)
+
+	// then
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "pod (3/3)\r\n  NAME STATUS\r\n> frontend-7c77b68cff-qbvsd   Running\r\n")
+}
+
+func TestPick_Empty(t *testing.T) {
+	// when
+	_, err := NewPicker(strings.NewReader("\r"), &bytes.Buffer{}).Pick("pod", "", nil)
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestFuzzyScore(t *testing.T) {
+	// when
+	_, subsequence := fuzzyScore("fe7c", "frontend-7c77b68cff")
+	_, missing := fuzzyScore("xyz", "frontend-7c77b68cff")
+	prefix, _ := fuzzyScore("back", "backend-5d4f8b9c6")
+	scattered, _ := fuzzyScore("back", "b-a-c-k")
+
+	// then
+	assert.True(t, subsequence)
+	assert.False(t, missing)
+	assert.Greater(t, prefix, scattered)
+}
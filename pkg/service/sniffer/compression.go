@@ -0,0 +1,186 @@
+package sniffer
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"ksniff/kube"
+	"ksniff/utils"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var SupportedCompressions = []string{CompressionNone, CompressionGzip, CompressionZstd}
+
+// Remote compressor commands, favoring speed since they run next to the workload
+var compressorCommands = map[string]string{
+	CompressionGzip: "gzip -1 -c",
+	CompressionZstd: "zstd -1 -c -q",
+}
+
+func IsSupportedCompression(compression string) bool {
+	for _, supported := range SupportedCompressions {
+		if compression == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveCompression returns the given compression when its compressor (and a shell to pipe into it)
+// is available on the container, falling back to no compression otherwise.
+func resolveCompression(ctx context.Context, service kube.KubernetesApiService, podName string, containerName string, compression string) string {
+	if compression == "" || compression == CompressionNone {
+		return CompressionNone
+	}
+
+	compressor := strings.Fields(compressorCommands[compression])[0]
+	command := []string{"/bin/sh", "-c", "command -v " + compressor}
+
+	exitCode, err := service.ExecuteCommand(ctx, podName, containerName, command, &kube.NopWriter{})
+	if err != nil || exitCode != 0 {
+		log.Warnf("'%s' isn't available on container: '%s', capturing without compression", compressor, containerName)
+		return CompressionNone
+	}
+
+	return compression
+}
+
+// Pipes the command through the compressor and exits with the status of the command rather than the one of
+// the compressor, which a shell without pipefail would return. The status goes through fd 3, the output through fd 4.
+const compressorScript = `exec 4>&1
+status=$({ { %s 3>&- 4>&-; echo $? >&3; } | %s >&4 3>&-; } 3>&1)
+exit "$status"`
+
+// wrapWithCompressor pipes the output of the given command through the remote compressor
+func wrapWithCompressor(command []string, compression string) []string {
+	compressor, ok := compressorCommands[compression]
+	if !ok {
+		return command
+	}
+
+	quotedCommand := make([]string, len(command))
+	for i, arg := range command {
+		quotedCommand[i] = utils.ShellQuote(arg)
+	}
+
+	return []string{"/bin/sh", "-c", fmt.Sprintf(compressorScript, strings.Join(quotedCommand, " "), compressor)}
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// decompressingWriter decompresses the remote capture stream before handing it to the output writer
+type decompressingWriter struct {
+	pipeWriter   *io.PipeWriter
+	compressed   *countingWriter
+	decompressed *countingWriter
+	done         chan error
+	startedAt    time.Time
+}
+
+func newDecompressingWriter(compression string, output io.Writer) *decompressingWriter {
+	pipeReader, pipeWriter := io.Pipe()
+
+	d := &decompressingWriter{
+		pipeWriter:   pipeWriter,
+		decompressed: &countingWriter{writer: output},
+		done:         make(chan error, 1),
+		startedAt:    time.Now(),
+	}
+	d.compressed = &countingWriter{writer: pipeWriter}
+
+	go func() {
+		err := decompress(compression, pipeReader, d.decompressed)
+		// Unblock the remote stream if decompression stopped early
+		_ = pipeReader.CloseWithError(err)
+		d.done <- err
+	}()
+
+	return d
+}
+
+func decompress(compression string, compressed io.Reader, output io.Writer) error {
+	switch compression {
+	case CompressionGzip:
+		reader, err := gzip.NewReader(compressed)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(output, reader)
+		return err
+	case CompressionZstd:
+		reader, err := zstd.NewReader(compressed)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(output, reader)
+		return err
+	default:
+		return errors.Errorf("unsupported compression: '%s'", compression)
+	}
+}
+
+func (d *decompressingWriter) Write(p []byte) (int, error) {
+	return d.compressed.Write(p)
+}
+
+// Close waits for the decompression to complete and reports the stream statistics
+func (d *decompressingWriter) Close() error {
+	_ = d.pipeWriter.Close()
+	err := <-d.done
+
+	if d.compressed.count == 0 {
+		// The capture produced no output at all, there is nothing to decompress
+		return nil
+	}
+
+	elapsed := time.Since(d.startedAt).Seconds()
+	ratio := float64(d.decompressed.count) / float64(d.compressed.count)
+
+	log.Infof("capture stream: received %s, decompressed to %s (ratio: %.2fx), throughput: %s/s",
+		kube.FormatBytes(float64(d.compressed.count)), kube.FormatBytes(float64(d.decompressed.count)),
+		ratio, kube.FormatBytes(float64(d.decompressed.count)/elapsed))
+
+	return err
+}
+
+// executeCapture runs the capture command, compressing its output in transit when requested
+func executeCapture(compression string, command []string, stdOut io.Writer,
+	execute func(command []string, stdOut io.Writer) (int, error)) (int, error) {
+	if compression == "" || compression == CompressionNone {
+		return execute(command, stdOut)
+	}
+
+	output := newDecompressingWriter(compression, stdOut)
+
+	exitCode, err := execute(wrapWithCompressor(command, compression), output)
+
+	if closeErr := output.Close(); closeErr != nil && err == nil {
+		err = errors.Wrap(closeErr, "failed to decompress capture stream")
+	}
+
+	return exitCode, err
+}
@@ -0,0 +1,115 @@
+package sniffer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapWithCompressor(t *testing.T) {
+	// when
+	command := wrapWithCompressor([]string{"tcpdump", "-i", "any", "-U", "-w", "-", "port 80"}, CompressionGzip)
+
+	// then
+	assert.Equal(t, []string{"/bin/sh", "-c", "exec 4>&1\n" +
+		"status=$({ { 'tcpdump' '-i' 'any' '-U' '-w' '-' 'port 80' 3>&- 4>&-; echo $? >&3; } | gzip -1 -c >&4 3>&-; } 3>&1)\n" +
+		"exit \"$status\""}, command)
+}
+
+func TestWrapWithCompressor_KeepsTheCommandExitCode(t *testing.T) {
+	if _, err := exec.LookPath("gzip"); err != nil {
+		t.Skip("gzip isn't available")
+	}
+
+	// given
+	command := wrapWithCompressor([]string{"sh", "-c", "echo pcap data; exit 3"}, CompressionGzip)
+
+	// when
+	var output bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = &output
+	err := cmd.Run()
+
+	// then
+	exitErr, ok := err.(*exec.ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, 3, exitErr.ExitCode())
+	reader, err := gzip.NewReader(&output)
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "pcap data\n", string(data))
+}
+
+func TestWrapWithCompressor_None(t *testing.T) {
+	// given
+	command := []string{"tcpdump", "-i", "any"}
+
+	// then
+	assert.Equal(t, command, wrapWithCompressor(command, CompressionNone))
+}
+
+func TestExecuteCapture_Gzip(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	var executedCommand []string
+	execute := func(command []string, stdOut io.Writer) (int, error) {
+		executedCommand = command
+		writer := gzip.NewWriter(stdOut)
+		_, _ = writer.Write([]byte("pcap data"))
+		return 0, writer.Close()
+	}
+
+	// when
+	exitCode, err := executeCapture(CompressionGzip, []string{"tcpdump"}, &output, execute)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "pcap data", output.String())
+	assert.Equal(t, "/bin/sh", executedCommand[0])
+}
+
+func TestExecuteCapture_Zstd(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	execute := func(command []string, stdOut io.Writer) (int, error) {
+		writer, err := zstd.NewWriter(stdOut)
+		assert.Nil(t, err)
+		_, _ = writer.Write([]byte("pcap data"))
+		return 0, writer.Close()
+	}
+
+	// when
+	_, err := executeCapture(CompressionZstd, []string{"tcpdump"}, &output, execute)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "pcap data", output.String())
+}
+
+func TestExecuteCapture_EmptyStream(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	execute := func(command []string, stdOut io.Writer) (int, error) {
+		return 1, nil
+	}
+
+	// when
+	exitCode, err := executeCapture(CompressionGzip, []string{"tcpdump"}, &output, execute)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 0, output.Len())
+}
+
+func TestIsSupportedCompression(t *testing.T) {
+	assert.True(t, IsSupportedCompression(CompressionZstd))
+	assert.False(t, IsSupportedCompression("lz4"))
+}
@@ -0,0 +1,156 @@
+package sniffer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+
+	"ksniff/kube"
+	"ksniff/pkg/config"
+	"ksniff/pkg/service/sniffer/runtime"
+)
+
+const hostVethDefaultImage = "maintained/tcpdump"
+
+// Capturing on the host interfaces needs the host network only, promiscuous mode included
+var hostVethHelperRequirements = runtime.HelperRequirements{
+	HostNetwork:  true,
+	Capabilities: []v1.Capability{"NET_RAW", "NET_ADMIN"},
+}
+
+// Prints the host interface routing to the given pod IP, followed by 'veth' when the interface
+// is one end of a veth pair (its iflink points at the peer) or 'shared' for bridges and alike.
+const findHostInterfaceScript = `
+set -e
+dev=$(ip -o route get %s 2>/dev/null | sed -n 's/.* dev \([^ ]*\).*/\1/p')
+if [ -z "$dev" ]; then
+    echo "no route to pod ip on host" >&2
+    exit 1
+fi
+if [ "$(cat /sys/class/net/$dev/iflink)" != "$(cat /sys/class/net/$dev/ifindex)" ]; then
+    echo "$dev veth"
+else
+    echo "$dev shared"
+fi
+`
+
+type HostVethSnifferService struct {
+	settings                *config.KsniffSettings
+	privilegedPod           *v1.Pod
+	privilegedContainerName string
+	hostInterface           string
+	hostInterfaceShared     bool
+	kubernetesApiService    kube.KubernetesApiService
+	compression             string
+}
+
+func NewHostVethSniffingService(options *config.KsniffSettings, service kube.KubernetesApiService) SnifferService {
+	return &HostVethSnifferService{settings: options, privilegedContainerName: "ksniff-privileged", kubernetesApiService: service}
+}
+
+func (h *HostVethSnifferService) Setup(ctx context.Context) error {
+	var err error
+
+	log.Infof("creating host network pod on node: '%s'", h.settings.DetectedPodNodeName)
+
+	if h.settings.UseDefaultImage {
+		h.settings.Image = hostVethDefaultImage
+	}
+
+	h.privilegedPod, err = h.kubernetesApiService.CreatePrivilegedPod(
+		ctx,
+		h.settings.DetectedPodNodeName,
+		h.privilegedContainerName,
+		h.settings.Image,
+		hostVethHelperRequirements,
+		h.settings.UserSpecifiedPodCreateTimeout,
+		h.settings.UserSpecifiedServiceAccount,
+		h.settings.PrivilegedPodOptions,
+	)
+	if err != nil {
+		log.WithError(err).Errorf("failed to create host network pod on node: '%s'", h.settings.DetectedPodNodeName)
+		return err
+	}
+
+	log.Infof("pod: '%s' created successfully on node: '%s'", h.privilegedPod.Name, h.settings.DetectedPodNodeName)
+
+	h.compression = resolveCompression(ctx, h.kubernetesApiService, h.privilegedPod.Name, h.privilegedContainerName, h.settings.UserSpecifiedCompression)
+
+	var buff bytes.Buffer
+	command := []string{"/bin/sh", "-c", fmt.Sprintf(findHostInterfaceScript, h.settings.DetectedPodIP)}
+	exitCode, err := h.kubernetesApiService.ExecuteCommand(ctx, h.privilegedPod.Name, h.privilegedContainerName, command, &buff)
+	if err != nil || exitCode != 0 {
+		return errors.Errorf("failed to find host interface of pod ip: '%s', exit code: '%d'", h.settings.DetectedPodIP, exitCode)
+	}
+
+	fields := strings.Fields(buff.String())
+	if len(fields) != 2 {
+		return errors.Errorf("unexpected host interface lookup output: '%s'", buff.String())
+	}
+
+	h.hostInterface = fields[0]
+	h.hostInterfaceShared = fields[1] != "veth"
+
+	log.Infof("pod ip: '%s' is reachable through host interface: '%s'", h.settings.DetectedPodIP, h.hostInterface)
+
+	return nil
+}
+
+func (h *HostVethSnifferService) Cleanup(ctx context.Context) error {
+	if h.privilegedPod == nil {
+		return nil
+	}
+
+	log.Infof("removing pod: '%s'", h.privilegedPod.Name)
+
+	err := h.kubernetesApiService.DeletePod(ctx, h.privilegedPod.Name)
+	if err != nil {
+		log.WithError(err).Errorf("failed to remove pod: '%s", h.privilegedPod.Name)
+		return err
+	}
+
+	log.Infof("pod: '%s' removed successfully", h.privilegedPod.Name)
+
+	return nil
+}
+
+func (h *HostVethSnifferService) buildFilter() string {
+	if !h.hostInterfaceShared {
+		return h.settings.UserSpecifiedFilter
+	}
+
+	// Bridges carry the traffic of every pod on the node, keep only the target pod
+	podFilter := fmt.Sprintf("host %s", h.settings.DetectedPodIP)
+	if h.settings.UserSpecifiedFilter == "" {
+		return podFilter
+	}
+
+	return fmt.Sprintf("(%s) and (%s)", podFilter, h.settings.UserSpecifiedFilter)
+}
+
+func (h *HostVethSnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	log.Infof("starting remote sniffing on host interface: '%s'", h.hostInterface)
+
+	command := []string{"tcpdump", "-i", h.hostInterface, "-U", "-w", "-", h.buildFilter()}
+
+	exitCode, err := executeCapture(h.compression, command, stdOut, func(command []string, stdOut io.Writer) (int, error) {
+		return h.kubernetesApiService.ExecuteCommand(ctx, h.privilegedPod.Name, h.privilegedContainerName, command, stdOut)
+	})
+	if err != nil {
+		log.WithError(err).Errorf("failed to start sniffing on host interface, exit code: '%d'", exitCode)
+		if exitCode != 0 {
+			return &CaptureExitError{ExitCode: exitCode}
+		}
+		return err
+	}
+
+	log.Info("remote sniffing on host interface completed")
+
+	return nil
+}
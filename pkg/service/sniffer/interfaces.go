@@ -0,0 +1,314 @@
+package sniffer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"ksniff/kube"
+	"ksniff/pkg/config"
+	"ksniff/pkg/service/sniffer/runtime"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+const interfacesHelperDefaultImage = "busybox"
+
+// Prints the links and addresses of the network namespace with ip, or else the links from sysfs
+// and the IPv6 addresses from procfs, which are the only ones readable without netlink.
+const listInterfacesScript = `
+if ip -o link show >/dev/null 2>&1; then
+  ip -o link show
+  ip -o addr show
+  exit
+fi
+for i in /sys/class/net/*; do
+  [ -e "$i" ] && echo "sysfs ${i##*/} $(cat "$i/mtu") $(cat "$i/type") $(cat "$i/operstate")"
+done
+while read -r address index prefix scope flags name; do
+  echo "inet6 $name $address $prefix"
+done 2>/dev/null < /proc/net/if_inet6
+true
+`
+
+// Finds a process of the container by its id, which every runtime puts in the cgroup path,
+// and lists the links and addresses of its network namespace.
+const enterInterfacesScript = `
+pid=$(grep -l "%s" /proc/[0-9]*/cgroup 2>/dev/null | head -n 1 | cut -d / -f 3)
+if [ -z "$pid" ]; then
+  echo "no process of the container found" >&2
+  exit 1
+fi
+nsenter -t "$pid" -n -- ip -o link show && nsenter -t "$pid" -n -- ip -o addr show
+`
+
+// Entering the network namespace of a process of the target container needs to see and trace it
+var interfacesHelperRequirements = runtime.HelperRequirements{
+	HostPID:      true,
+	Capabilities: []v1.Capability{"SYS_ADMIN", "SYS_PTRACE"},
+}
+
+// ARPHRD link types of /sys/class/net/<interface>/type, named as ip names them
+var sysfsLinkTypes = map[string]string{
+	"1":     "ether",
+	"32":    "infiniband",
+	"280":   "can",
+	"768":   "ipip",
+	"769":   "tunnel6",
+	"772":   "loopback",
+	"776":   "sit",
+	"778":   "gre",
+	"823":   "gre6",
+	"65534": "none",
+}
+
+// NetworkInterface is an interface of the network namespace of the target container
+type NetworkInterface struct {
+	Name     string
+	LinkType string
+	// Zero when unknown
+	MTU       int
+	State     string
+	Addresses []string
+}
+
+// InterfacesService lists the interfaces the capture can use, from the target container itself
+// or, in privileged and host side veth modes, from a helper pod entering its network namespace.
+type InterfacesService struct {
+	settings             *config.KsniffSettings
+	kubernetesApiService kube.KubernetesApiService
+	helperPod            *v1.Pod
+	helperContainerName  string
+	uploadService        SnifferService
+}
+
+func NewInterfacesService(options *config.KsniffSettings, service kube.KubernetesApiService) *InterfacesService {
+	return &InterfacesService{settings: options, kubernetesApiService: service, helperContainerName: "ksniff-interfaces"}
+}
+
+func (i *InterfacesService) List(ctx context.Context) ([]NetworkInterface, error) {
+	if i.settings.UserSpecifiedPrivilegedMode || i.settings.UserSpecifiedHostVethMode {
+		return i.listFromHelperPod(ctx)
+	}
+
+	var buff bytes.Buffer
+	command := []string{"/bin/sh", "-c", listInterfacesScript}
+	exitCode, err := i.kubernetesApiService.ExecuteCommand(ctx, i.settings.UserSpecifiedPodName, i.settings.UserSpecifiedContainer, command, &buff)
+	if err == nil && exitCode == 0 {
+		return parseInterfaces(buff.String()), nil
+	}
+
+	log.WithError(err).Warnf("failed to list interfaces with a shell, exit code: '%d', falling back to static tcpdump", exitCode)
+
+	return i.listWithStaticTcpdump(ctx)
+}
+
+// listWithStaticTcpdump uploads static tcpdump, which only tells the interface names and whether they're up
+func (i *InterfacesService) listWithStaticTcpdump(ctx context.Context) ([]NetworkInterface, error) {
+	i.uploadService = NewUploadTcpdumpRemoteSniffingService(i.settings, i.kubernetesApiService)
+	if err := i.uploadService.Setup(ctx); err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	command := []string{i.settings.UserSpecifiedRemoteTcpdumpPath, "-D"}
+	exitCode, err := i.kubernetesApiService.ExecuteCommand(ctx, i.settings.UserSpecifiedPodName, i.settings.UserSpecifiedContainer, command, &buff)
+	if err != nil || exitCode != 0 {
+		return nil, errors.Errorf("listing interfaces with static tcpdump failed, exit code: '%d'", exitCode)
+	}
+
+	return parseTcpdumpInterfaces(buff.String()), nil
+}
+
+func (i *InterfacesService) listFromHelperPod(ctx context.Context) ([]NetworkInterface, error) {
+	var err error
+
+	image := i.settings.Image
+	if i.settings.UseDefaultImage {
+		image = interfacesHelperDefaultImage
+	}
+
+	log.Infof("creating pod on node: '%s' to enter the network namespace of container: '%s'",
+		i.settings.DetectedPodNodeName, i.settings.UserSpecifiedContainer)
+
+	i.helperPod, err = i.kubernetesApiService.CreatePrivilegedPod(
+		ctx,
+		i.settings.DetectedPodNodeName,
+		i.helperContainerName,
+		image,
+		interfacesHelperRequirements,
+		i.settings.UserSpecifiedPodCreateTimeout,
+		i.settings.UserSpecifiedServiceAccount,
+		i.settings.PrivilegedPodOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+	command := []string{"/bin/sh", "-c", fmt.Sprintf(enterInterfacesScript, i.settings.DetectedContainerId)}
+	exitCode, err := i.kubernetesApiService.ExecuteCommand(ctx, i.helperPod.Name, i.helperContainerName, command, &buff)
+	if err != nil || exitCode != 0 {
+		return nil, errors.Errorf("listing interfaces from pod: '%s' failed, exit code: '%d'", i.helperPod.Name, exitCode)
+	}
+
+	return parseInterfaces(buff.String()), nil
+}
+
+// Cleanup removes the helper pod or the upload helper pod created while listing
+func (i *InterfacesService) Cleanup(ctx context.Context) error {
+	if i.uploadService != nil {
+		return i.uploadService.Cleanup(ctx)
+	}
+
+	if i.helperPod == nil {
+		return nil
+	}
+
+	log.Infof("removing pod: '%s'", i.helperPod.Name)
+
+	err := i.kubernetesApiService.DeletePod(ctx, i.helperPod.Name)
+	if err != nil {
+		log.WithError(err).Errorf("failed to remove pod: '%s", i.helperPod.Name)
+		return err
+	}
+
+	log.Infof("pod: '%s' removed successfully", i.helperPod.Name)
+
+	return nil
+}
+
+// parseInterfaces reads the one line records of ip -o link and ip -o addr,
+// and the sysfs and inet6 records of the fallback script
+func parseInterfaces(output string) []NetworkInterface {
+	var interfaces []NetworkInterface
+	indexes := map[string]int{}
+
+	lookup := func(name string) *NetworkInterface {
+		index, ok := indexes[name]
+		if !ok {
+			index = len(interfaces)
+			indexes[name] = index
+			interfaces = append(interfaces, NetworkInterface{Name: name})
+		}
+
+		return &interfaces[index]
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "sysfs" && len(fields) == 5:
+			networkInterface := lookup(fields[1])
+			networkInterface.MTU, _ = strconv.Atoi(fields[2])
+			networkInterface.LinkType = sysfsLinkType(fields[3])
+			networkInterface.State = fields[4]
+		case fields[0] == "inet6" && len(fields) == 4:
+			if address := procfsIPv6Address(fields[2], fields[3]); address != "" {
+				networkInterface := lookup(fields[1])
+				networkInterface.Addresses = append(networkInterface.Addresses, address)
+			}
+		case strings.HasSuffix(fields[0], ":") && (fields[2] == "inet" || fields[2] == "inet6") && len(fields) > 3:
+			networkInterface := lookup(ipInterfaceName(fields[1]))
+			networkInterface.Addresses = append(networkInterface.Addresses, fields[3])
+		case strings.HasSuffix(fields[0], ":"):
+			networkInterface := lookup(ipInterfaceName(fields[1]))
+			for index, field := range fields[:len(fields)-1] {
+				switch field {
+				case "mtu":
+					networkInterface.MTU, _ = strconv.Atoi(fields[index+1])
+				case "state":
+					networkInterface.State = strings.ToLower(fields[index+1])
+				}
+			}
+			for _, field := range fields {
+				if strings.HasPrefix(field, "link/") {
+					networkInterface.LinkType = strings.TrimPrefix(field, "link/")
+				}
+			}
+		}
+	}
+
+	return interfaces
+}
+
+// ipInterfaceName strips the colon and the peer of veth pairs, e.g. eth0@if12:
+func ipInterfaceName(field string) string {
+	name := strings.TrimSuffix(field, ":")
+	if index := strings.Index(name, "@"); index > 0 {
+		name = name[:index]
+	}
+
+	return name
+}
+
+func sysfsLinkType(arphrd string) string {
+	if linkType, ok := sysfsLinkTypes[arphrd]; ok {
+		return linkType
+	}
+
+	return "arphrd-" + arphrd
+}
+
+// procfsIPv6Address formats an address of /proc/net/if_inet6, 32 hex digits and a hex prefix length
+func procfsIPv6Address(hexAddress string, hexPrefix string) string {
+	if len(hexAddress) != 32 {
+		return ""
+	}
+
+	address := make(net.IP, net.IPv6len)
+	for index := range address {
+		value, err := strconv.ParseUint(hexAddress[2*index:2*index+2], 16, 8)
+		if err != nil {
+			return ""
+		}
+		address[index] = byte(value)
+	}
+
+	prefix, err := strconv.ParseUint(hexPrefix, 16, 8)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%d", address, prefix)
+}
+
+// parseTcpdumpInterfaces reads tcpdump -D, e.g. "1.eth0 [Up, Running, Connected]". Devices with a description
+// are pseudo devices such as any, nflog or usbmon, which aren't interfaces of the network namespace.
+func parseTcpdumpInterfaces(output string) []NetworkInterface {
+	var interfaces []NetworkInterface
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.Contains(line, "(") {
+			continue
+		}
+
+		name := fields[0]
+		if index := strings.Index(name, "."); index >= 0 {
+			name = name[index+1:]
+		}
+
+		state := "down"
+		if strings.Contains(line, "[Up") {
+			state = "up"
+		}
+
+		linkType := ""
+		if strings.Contains(line, "Loopback") {
+			linkType = "loopback"
+		}
+
+		interfaces = append(interfaces, NetworkInterface{Name: name, LinkType: linkType, State: state})
+	}
+
+	return interfaces
+}
@@ -0,0 +1,138 @@
+package sniffer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ksniff/kube"
+	"ksniff/kube/fakeexec"
+	"ksniff/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const ipOutput = `1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+3: eth0@if12: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1450 qdisc noqueue state UP mode DEFAULT group default \    link/ether 0a:58:0a:f4:00:05 brd ff:ff:ff:ff:ff:ff link-netnsid 0
+4: net1@if3: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 9000 qdisc noqueue state UP mode DEFAULT group default \    link/ether 72:1c:3e:4f:a0:11 brd ff:ff:ff:ff:ff:ff link-netnsid 0
+5: wg0: <POINTOPOINT,NOARP,UP,LOWER_UP> mtu 1420 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000\    link/none
+1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+3: eth0    inet 10.244.0.5/24 brd 10.244.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+3: eth0    inet6 fe80::858:aff:fef4:5/64 scope link \       valid_lft forever preferred_lft forever
+4: net1    inet 192.168.100.7/24 brd 192.168.100.255 scope global net1\       valid_lft forever preferred_lft forever
+`
+
+func newInterfacesService(t *testing.T) (*fakeexec.Server, *InterfacesService, func()) {
+	dir, err := ioutil.TempDir("", "ksniff-interfaces")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "tmp"), 0755))
+
+	localTcpdumpPath := filepath.Join(dir, "static-tcpdump")
+	assert.Nil(t, ioutil.WriteFile(localTcpdumpPath, []byte("static tcpdump"), 0755))
+
+	server := fakeexec.NewServer(dir)
+
+	settings := config.NewKsniffSettings()
+	settings.UserSpecifiedPodName = "pod"
+	settings.UserSpecifiedContainer = "container"
+	settings.UserSpecifiedLocalTcpdumpPath = localTcpdumpPath
+	settings.UserSpecifiedRemoteTcpdumpPath = "/tmp/static-tcpdump"
+	settings.UserSpecifiedCompression = CompressionNone
+
+	kubernetesApiService := kube.NewKubernetesApiService(server.Clientset(fake.NewSimpleClientset()),
+		server.RestConfig(), "default", kube.ExecTransportWebsocket, nil)
+
+	return server, NewInterfacesService(settings, kubernetesApiService), func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestInterfacesService_ListWithShell(t *testing.T) {
+	// given
+	server, service, cleanup := newInterfacesService(t)
+	defer cleanup()
+	server.Handle("/bin/sh", func(cmd *fakeexec.Command) int {
+		_, _ = fmt.Fprint(cmd.StdOut, ipOutput)
+		return 0
+	})
+
+	// when
+	interfaces, err := service.List(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Len(t, interfaces, 4)
+	assert.Equal(t, NetworkInterface{Name: "net1", LinkType: "ether", MTU: 9000, State: "up",
+		Addresses: []string{"192.168.100.7/24"}}, interfaces[2])
+	assert.Nil(t, service.Cleanup(context.Background()))
+}
+
+func TestInterfacesService_FallsBackToStaticTcpdump(t *testing.T) {
+	// given
+	server, service, cleanup := newInterfacesService(t)
+	defer cleanup()
+	server.Handle("/tmp/static-tcpdump", func(cmd *fakeexec.Command) int {
+		_, _ = fmt.Fprint(cmd.StdOut, "1.eth0 [Up, Running, Connected]\n2.any (Pseudo-device that captures on all interfaces) [Up, Running]\n3.lo [Up, Running, Loopback]\n")
+		return 0
+	})
+
+	// when
+	interfaces, err := service.List(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []NetworkInterface{{Name: "eth0", State: "up"}, {Name: "lo", LinkType: "loopback", State: "up"}}, interfaces)
+	assert.Contains(t, server.Commands(), "/tmp/static-tcpdump -D")
+	assert.Nil(t, service.Cleanup(context.Background()))
+}
+
+func TestParseInterfaces_Ip(t *testing.T) {
+	// when
+	interfaces := parseInterfaces(ipOutput)
+
+	// then
+	assert.Equal(t, []NetworkInterface{
+		{Name: "lo", LinkType: "loopback", MTU: 65536, State: "unknown", Addresses: []string{"127.0.0.1/8"}},
+		{Name: "eth0", LinkType: "ether", MTU: 1450, State: "up", Addresses: []string{"10.244.0.5/24", "fe80::858:aff:fef4:5/64"}},
+		{Name: "net1", LinkType: "ether", MTU: 9000, State: "up", Addresses: []string{"192.168.100.7/24"}},
+		{Name: "wg0", LinkType: "none", MTU: 1420, State: "unknown"},
+	}, interfaces)
+}
+
+func TestParseInterfaces_Sysfs(t *testing.T) {
+	// given
+	output := "sysfs eth0 1450 1 up\nsysfs lo 65536 772 unknown\nsysfs tun0 1500 999 down\n" +
+		"inet6 eth0 fe800000000000000858aafffef40005 40\ninet6 lo 00000000000000000000000000000001 80\n"
+
+	// when
+	interfaces := parseInterfaces(output)
+
+	// then
+	assert.Equal(t, []NetworkInterface{
+		{Name: "eth0", LinkType: "ether", MTU: 1450, State: "up", Addresses: []string{"fe80::858:aaff:fef4:5/64"}},
+		{Name: "lo", LinkType: "loopback", MTU: 65536, State: "unknown", Addresses: []string{"::1/128"}},
+		{Name: "tun0", LinkType: "arphrd-999", MTU: 1500, State: "down"},
+	}, interfaces)
+}
+
+func TestParseTcpdumpInterfaces(t *testing.T) {
+	// given
+	output := "1.eth0 [Up, Running, Connected]\n2.net1 [Up, Running, Connected]\n3.any (Pseudo-device that captures on all interfaces) [Up, Running]\n" +
+		"4.lo [Up, Running, Loopback]\n5.wg0 [none]\n6.nflog (Linux netfilter log (NFLOG) interface) [none]\n"
+
+	// when
+	interfaces := parseTcpdumpInterfaces(output)
+
+	// then
+	assert.Equal(t, []NetworkInterface{
+		{Name: "eth0", State: "up"},
+		{Name: "net1", State: "up"},
+		{Name: "lo", LinkType: "loopback", State: "up"},
+		{Name: "wg0", State: "down"},
+	}, interfaces)
+}
@@ -2,7 +2,9 @@ package sniffer
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
@@ -19,13 +21,16 @@ type PrivilegedPodSnifferService struct {
 	targetProcessId         *string
 	kubernetesApiService    kube.KubernetesApiService
 	runtimeBridge           runtime.ContainerRuntimeBridge
+	compression             string
+	// Bridges keep track of the tcpdump containers they start, one per captured interface
+	bridgeMutex sync.Mutex
 }
 
 func NewPrivilegedPodRemoteSniffingService(options *config.KsniffSettings, service kube.KubernetesApiService, bridge runtime.ContainerRuntimeBridge) SnifferService {
 	return &PrivilegedPodSnifferService{settings: options, privilegedContainerName: "ksniff-privileged", kubernetesApiService: service, runtimeBridge: bridge}
 }
 
-func (p *PrivilegedPodSnifferService) Setup() error {
+func (p *PrivilegedPodSnifferService) Setup(ctx context.Context) error {
 	var err error
 
 	log.Infof("creating privileged pod on node: '%s'", p.settings.DetectedPodNodeName)
@@ -43,12 +48,14 @@ func (p *PrivilegedPodSnifferService) Setup() error {
 	}
 
 	p.privilegedPod, err = p.kubernetesApiService.CreatePrivilegedPod(
+		ctx,
 		p.settings.DetectedPodNodeName,
 		p.privilegedContainerName,
 		p.settings.Image,
-		p.settings.SocketPath,
+		p.runtimeBridge.HelperRequirements(p.settings.SocketPath),
 		p.settings.UserSpecifiedPodCreateTimeout,
 		p.settings.UserSpecifiedServiceAccount,
+		p.settings.PrivilegedPodOptions,
 	)
 	if err != nil {
 		log.WithError(err).Errorf("failed to create privileged pod on node: '%s'", p.settings.DetectedPodNodeName)
@@ -57,10 +64,12 @@ func (p *PrivilegedPodSnifferService) Setup() error {
 
 	log.Infof("pod: '%s' created successfully on node: '%s'", p.privilegedPod.Name, p.settings.DetectedPodNodeName)
 
+	p.compression = resolveCompression(ctx, p.kubernetesApiService, p.privilegedPod.Name, p.privilegedContainerName, p.settings.UserSpecifiedCompression)
+
 	if p.runtimeBridge.NeedsPid() {
 		var buff bytes.Buffer
 		command := p.runtimeBridge.BuildInspectCommand(p.settings.DetectedContainerId)
-		exitCode, err := p.kubernetesApiService.ExecuteCommand(p.privilegedPod.Name, p.privilegedContainerName, command, &buff)
+		exitCode, err := p.kubernetesApiService.ExecuteCommand(ctx, p.privilegedPod.Name, p.privilegedContainerName, command, &buff)
 		if err != nil {
 			log.WithError(err).Errorf("failed to start sniffing using privileged pod, exit code: '%d'", exitCode)
 		}
@@ -73,12 +82,18 @@ func (p *PrivilegedPodSnifferService) Setup() error {
 	return nil
 }
 
-func (p *PrivilegedPodSnifferService) Cleanup() error {
+func (p *PrivilegedPodSnifferService) Cleanup(ctx context.Context) error {
+	if p.privilegedPod == nil {
+		return nil
+	}
+
+	p.bridgeMutex.Lock()
 	command := p.runtimeBridge.BuildCleanupCommand()
+	p.bridgeMutex.Unlock()
 
 	if command != nil {
 		log.Infof("removing privileged container: '%s'", p.privilegedContainerName)
-		exitCode, err := p.kubernetesApiService.ExecuteCommand(p.privilegedPod.Name, p.privilegedContainerName, command, &kube.NopWriter{})
+		exitCode, err := p.kubernetesApiService.ExecuteCommand(ctx, p.privilegedPod.Name, p.privilegedContainerName, command, &kube.NopWriter{})
 		if err != nil {
 			log.WithError(err).Errorf("failed to remove privileged container: '%s', exit code: '%d', "+
 				"please manually remove it", p.privilegedContainerName, exitCode)
@@ -87,36 +102,45 @@ func (p *PrivilegedPodSnifferService) Cleanup() error {
 		}
 	}
 
-	if p.privilegedPod != nil {
-		log.Infof("removing pod: '%s'", p.privilegedPod.Name)
-
-		err := p.kubernetesApiService.DeletePod(p.privilegedPod.Name)
-		if err != nil {
-			log.WithError(err).Errorf("failed to remove pod: '%s", p.privilegedPod.Name)
-			return err
-		}
+	log.Infof("removing pod: '%s'", p.privilegedPod.Name)
 
-		log.Infof("pod: '%s' removed successfully", p.privilegedPod.Name)
+	err := p.kubernetesApiService.DeletePod(ctx, p.privilegedPod.Name)
+	if err != nil {
+		log.WithError(err).Errorf("failed to remove pod: '%s", p.privilegedPod.Name)
+		return err
 	}
 
+	log.Infof("pod: '%s' removed successfully", p.privilegedPod.Name)
+
 	return nil
 }
 
-func (p *PrivilegedPodSnifferService) Start(stdOut io.Writer) error {
-	log.Info("starting remote sniffing using privileged pod")
+func (p *PrivilegedPodSnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	return p.StartOnInterface(ctx, p.settings.UserSpecifiedInterface, stdOut)
+}
+
+func (p *PrivilegedPodSnifferService) StartOnInterface(ctx context.Context, netInterface string, stdOut io.Writer) error {
+	log.Infof("starting remote sniffing using privileged pod, interface: '%s'", netInterface)
 
+	p.bridgeMutex.Lock()
 	command := p.runtimeBridge.BuildTcpdumpCommand(
 		&p.settings.DetectedContainerId,
-		p.settings.UserSpecifiedInterface,
+		netInterface,
 		p.settings.UserSpecifiedFilter,
 		p.targetProcessId,
 		p.settings.SocketPath,
 		p.settings.TCPDumpImage,
 	)
+	p.bridgeMutex.Unlock()
 
-	exitCode, err := p.kubernetesApiService.ExecuteCommand(p.privilegedPod.Name, p.privilegedContainerName, command, stdOut)
+	exitCode, err := executeCapture(p.compression, command, stdOut, func(command []string, stdOut io.Writer) (int, error) {
+		return p.kubernetesApiService.ExecuteCommand(ctx, p.privilegedPod.Name, p.privilegedContainerName, command, stdOut)
+	})
 	if err != nil {
 		log.WithError(err).Errorf("failed to start sniffing using privileged pod, exit code: '%d'", exitCode)
+		if exitCode != 0 {
+			return &CaptureExitError{ExitCode: exitCode}
+		}
 		return err
 	}
 
@@ -0,0 +1,233 @@
+package sniffer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"ksniff/pkg/pcap"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
+
+// ReconnectingSnifferService restarts the capture of the wrapped service when its stream is lost,
+// e.g. by a load balancer idle timeout or an API server restart, but not when tcpdump exits with a failure. Every attempt is appended to a
+// single pcapng output, the first packet after a reconnection carries a comment marking the gap.
+// With several interfaces, their captures run at once and each one is described in the output.
+type ReconnectingSnifferService struct {
+	service        SnifferService
+	streams        []captureStream
+	maxReconnects  int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	stopped        chan struct{}
+	stopOnce       sync.Once
+}
+
+// captureStream is the capture of a single interface, unnamed for the one of the settings
+type captureStream struct {
+	netInterface string
+	start        func(ctx context.Context, stdOut io.Writer) error
+}
+
+func NewReconnectingSnifferService(service SnifferService, maxReconnects int) SnifferService {
+	return newReconnectingSnifferService(service, []captureStream{{start: service.Start}}, maxReconnects)
+}
+
+// NewMultiInterfaceSnifferService captures on every given interface after a single setup, merging the captures
+// into a pcapng output where each interface keeps its own description and link type.
+func NewMultiInterfaceSnifferService(service InterfaceSnifferService, interfaces []string, maxReconnects int) SnifferService {
+	var streams []captureStream
+	for _, netInterface := range interfaces {
+		netInterface := netInterface
+		streams = append(streams, captureStream{
+			netInterface: netInterface,
+			start: func(ctx context.Context, stdOut io.Writer) error {
+				return service.StartOnInterface(ctx, netInterface, stdOut)
+			},
+		})
+	}
+
+	return newReconnectingSnifferService(service, streams, maxReconnects)
+}
+
+func newReconnectingSnifferService(service SnifferService, streams []captureStream, maxReconnects int) *ReconnectingSnifferService {
+	return &ReconnectingSnifferService{
+		service:        service,
+		streams:        streams,
+		maxReconnects:  maxReconnects,
+		initialBackoff: reconnectInitialBackoff,
+		maxBackoff:     reconnectMaxBackoff,
+		stopped:        make(chan struct{}),
+	}
+}
+
+func (r *ReconnectingSnifferService) Setup(ctx context.Context) error {
+	return r.service.Setup(ctx)
+}
+
+func (r *ReconnectingSnifferService) Cleanup(ctx context.Context) error {
+	// A capture cut by the cleanup must not be restarted
+	r.stopOnce.Do(func() { close(r.stopped) })
+
+	return r.service.Cleanup(ctx)
+}
+
+func (r *ReconnectingSnifferService) isStopped() bool {
+	select {
+	case <-r.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// outputWriter records write failures, the output going away (e.g. wireshark closed) ends the capture
+type outputWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	err    error
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	n, err := o.writer.Write(p)
+	if err != nil {
+		o.mutex.Lock()
+		o.err = err
+		o.mutex.Unlock()
+	}
+	return n, err
+}
+
+func (o *outputWriter) failed() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.err != nil
+}
+
+func (r *ReconnectingSnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	output := &outputWriter{writer: stdOut}
+
+	ngWriter, err := pcap.NewNgWriter(output)
+	if err != nil {
+		return err
+	}
+
+	if len(r.streams) == 1 {
+		return r.capture(ctx, ngWriter, output, r.streams[0])
+	}
+
+	// The capture ends as soon as one of the interfaces can't be captured anymore
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(r.streams))
+	for _, stream := range r.streams {
+		go func(stream captureStream) {
+			err := r.capture(ctx, ngWriter, output, stream)
+			errs <- errors.Wrapf(err, "capture on interface: '%s' failed", stream.netInterface)
+			if err != nil {
+				cancel()
+			}
+		}(stream)
+	}
+
+	var firstErr error
+	for range r.streams {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// capture runs the capture of a single stream, restarting it until it ends on its own or is stopped
+func (r *ReconnectingSnifferService) capture(ctx context.Context, ngWriter *pcap.NgWriter, output *outputWriter, stream captureStream) error {
+	backoff := r.initialBackoff
+	failures := 0
+	comment := ""
+
+	description := "capture stream"
+	if stream.netInterface != "" {
+		description = fmt.Sprintf("capture stream of interface: '%s'", stream.netInterface)
+	}
+
+	for {
+		packets, err := r.startAttempt(ctx, ngWriter, stream, comment)
+		if err == nil || r.isStopped() || ctx.Err() != nil || output.failed() {
+			return err
+		}
+
+		// tcpdump itself failed, e.g. on a bad filter, running it again wouldn't help
+		if _, exited := errors.Cause(err).(*CaptureExitError); exited {
+			return err
+		}
+
+		if packets > 0 {
+			// The stream was up, only consecutive failures count toward the limit
+			failures = 0
+			backoff = r.initialBackoff
+		}
+
+		if failures == r.maxReconnects {
+			return errors.Wrapf(err, "%s lost, giving up after '%d' reconnects", description, r.maxReconnects)
+		}
+
+		failures++
+		lostAt := time.Now()
+
+		log.WithError(err).Warnf("%s lost, reconnecting in: '%s' (attempt %d/%d)", description, backoff, failures, r.maxReconnects)
+
+		select {
+		case <-time.After(backoff):
+		case <-r.stopped:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+
+		comment = fmt.Sprintf("ksniff: capture stream lost at %s, reconnected at %s, packets in between were not captured",
+			lostAt.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
+	}
+}
+
+// startAttempt runs a single capture, converting its pcap stream into the pcapng output
+func (r *ReconnectingSnifferService) startAttempt(ctx context.Context, ngWriter *pcap.NgWriter, stream captureStream, comment string) (int, error) {
+	pipeReader, pipeWriter := io.Pipe()
+
+	var packets int
+	var copyErr error
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		packets, copyErr = pcap.CopyToNg(ngWriter, pipeReader, stream.netInterface, comment)
+		// Unblock the capture if the conversion stopped early
+		_ = pipeReader.CloseWithError(errors.Wrap(copyErr, "capture conversion stopped"))
+	}()
+
+	err := stream.start(ctx, pipeWriter)
+	_ = pipeWriter.Close()
+	<-done
+
+	if copyErr != nil {
+		return packets, copyErr
+	}
+
+	return packets, err
+}
@@ -0,0 +1,257 @@
+package sniffer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// singlePacketPcap returns a pcap stream holding a single packet with the given payload
+func singlePacketPcap(payload string) []byte {
+	var stream bytes.Buffer
+	_ = binary.Write(&stream, binary.LittleEndian, []uint32{0xa1b2c3d4, 0x00040002, 0, 0, 65535, 1, 1600000000, 0,
+		uint32(len(payload)), uint32(len(payload))})
+	stream.WriteString(payload)
+
+	return stream.Bytes()
+}
+
+// fakeSnifferService writes a single packet pcap stream on every start, failing the given number of times
+type fakeSnifferService struct {
+	failures  int
+	starts    int
+	cleanedUp bool
+}
+
+func (f *fakeSnifferService) Setup(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeSnifferService) Cleanup(ctx context.Context) error {
+	f.cleanedUp = true
+	return nil
+}
+
+func (f *fakeSnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	f.starts++
+
+	if _, err := stdOut.Write(singlePacketPcap("ping")); err != nil {
+		return err
+	}
+
+	if f.starts <= f.failures {
+		return errors.New("stream lost")
+	}
+
+	return nil
+}
+
+func newTestReconnectingService(service SnifferService, maxReconnects int) *ReconnectingSnifferService {
+	reconnecting := NewReconnectingSnifferService(service, maxReconnects).(*ReconnectingSnifferService)
+	reconnecting.initialBackoff = 0
+
+	return reconnecting
+}
+
+func TestReconnectingSnifferService_Reconnects(t *testing.T) {
+	// given
+	fake := &fakeSnifferService{failures: 2}
+	var output bytes.Buffer
+
+	// when
+	err := newTestReconnectingService(fake, 1).Start(context.Background(), &output)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fake.starts)
+	assert.Equal(t, 3, bytes.Count(output.Bytes(), []byte("ping")))
+	assert.Equal(t, 2, bytes.Count(output.Bytes(), []byte("ksniff: capture stream lost")))
+}
+
+func TestReconnectingSnifferService_GivesUp(t *testing.T) {
+	// given
+	fake := &fakeSnifferService{failures: 10}
+
+	// when
+	err := newTestReconnectingService(&emptySnifferService{fake}, 2).Start(context.Background(), &bytes.Buffer{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, fake.starts)
+}
+
+func TestReconnectingSnifferService_StopsAfterCleanup(t *testing.T) {
+	// given
+	fake := &fakeSnifferService{failures: 10}
+	service := newTestReconnectingService(&emptySnifferService{fake}, 5)
+
+	// when
+	assert.Nil(t, service.Cleanup(context.Background()))
+	err := service.Start(context.Background(), &bytes.Buffer{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.True(t, fake.cleanedUp)
+	assert.Equal(t, 1, fake.starts)
+}
+
+func TestReconnectingSnifferService_DoesNotReconnectWhenTcpdumpFails(t *testing.T) {
+	// given
+	fake := &exitingSnifferService{&fakeSnifferService{}}
+
+	// when
+	err := newTestReconnectingService(fake, 5).Start(context.Background(), &bytes.Buffer{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "exit code: '1'")
+	assert.Equal(t, 1, fake.starts)
+}
+
+// exitingSnifferService fails as tcpdump exiting on a bad filter does
+type exitingSnifferService struct {
+	*fakeSnifferService
+}
+
+func (e *exitingSnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	e.starts++
+	return &CaptureExitError{ExitCode: 1}
+}
+
+// emptySnifferService fails without capturing any packet, so failures are consecutive
+type emptySnifferService struct {
+	*fakeSnifferService
+}
+
+func (e *emptySnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	e.starts++
+	return errors.New("stream lost")
+}
+
+func TestReconnectingSnifferService_StopsWhenContextIsDone(t *testing.T) {
+	// given
+	fake := &fakeSnifferService{failures: 10}
+	service := newTestReconnectingService(&emptySnifferService{fake}, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	err := service.Start(ctx, &bytes.Buffer{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, fake.starts)
+}
+
+// fakeInterfaceSnifferService writes a single packet pcap stream with the link type of the interface
+type fakeInterfaceSnifferService struct {
+	fakeSnifferService
+	linkTypes map[string]uint32
+	failing   string
+}
+
+func (f *fakeInterfaceSnifferService) StartOnInterface(ctx context.Context, netInterface string, stdOut io.Writer) error {
+	if netInterface == f.failing {
+		return errors.New("no such device")
+	}
+
+	stream := singlePacketPcap(netInterface)
+	binary.LittleEndian.PutUint32(stream[20:], f.linkTypes[netInterface])
+	if _, err := stdOut.Write(stream); err != nil {
+		return err
+	}
+
+	// Keeps capturing until stopped, as tcpdump does
+	<-ctx.Done()
+
+	return nil
+}
+
+// pcapngInterfaces returns the name and link type of every interface description block of the stream
+func pcapngInterfaces(stream []byte) map[string]uint16 {
+	interfaces := map[string]uint16{}
+	for offset := 0; offset+12 <= len(stream); {
+		blockType := binary.LittleEndian.Uint32(stream[offset:])
+		length := int(binary.LittleEndian.Uint32(stream[offset+4:]))
+
+		if blockType == 1 {
+			body := stream[offset+8 : offset+length-4]
+			linkType := binary.LittleEndian.Uint16(body)
+			for options := body[8:]; len(options) >= 4; {
+				code := binary.LittleEndian.Uint16(options)
+				optionLength := int(binary.LittleEndian.Uint16(options[2:]))
+				if code == 2 {
+					interfaces[string(options[4:4+optionLength])] = linkType
+				}
+				options = options[4+optionLength+(4-optionLength%4)%4:]
+			}
+		}
+
+		offset += length
+	}
+
+	return interfaces
+}
+
+func TestMultiInterfaceSnifferService_MergesInterfaces(t *testing.T) {
+	// given
+	service := &fakeInterfaceSnifferService{linkTypes: map[string]uint32{"eth0": 1, "wg0": 101}}
+	multi := NewMultiInterfaceSnifferService(service, []string{"eth0", "wg0"}, 0)
+	output := &syncBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	done := make(chan error)
+	go func() {
+		done <- multi.Start(ctx, output)
+	}()
+	assert.Eventually(t, func() bool {
+		return len(pcapngInterfaces(output.Bytes())) == 2
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+
+	// then
+	assert.Nil(t, <-done)
+	assert.Equal(t, map[string]uint16{"eth0": 1, "wg0": 101}, pcapngInterfaces(output.Bytes()))
+}
+
+func TestMultiInterfaceSnifferService_FailingInterfaceStopsTheCapture(t *testing.T) {
+	// given
+	service := &fakeInterfaceSnifferService{linkTypes: map[string]uint32{"eth0": 1}, failing: "net1"}
+	multi := NewMultiInterfaceSnifferService(service, []string{"eth0", "net1"}, 0)
+
+	// when
+	err := multi.Start(context.Background(), &syncBuffer{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "capture on interface: 'net1' failed")
+	assert.Contains(t, err.Error(), "no such device")
+}
+
+// syncBuffer is a buffer read while the capture writes to it
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]byte{}, b.buffer.Bytes()...)
+}
@@ -3,11 +3,15 @@ package runtime
 import (
 	"fmt"
 	"ksniff/utils"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 type ContainerdBridge struct {
-	tcpdumpContainerName string
-	socketPath string
+	// Every tcpdump container started, one per captured interface
+	tcpdumpContainerNames []string
+	socketPath            string
 }
 
 func NewContainerdBridge() *ContainerdBridge {
@@ -31,7 +35,8 @@ func (d ContainerdBridge) GetDefaultSocketPath() string {
 }
 
 func (d *ContainerdBridge) BuildTcpdumpCommand(containerId *string, netInterface string, filter string, pid *string, socketPath string, tcpdumpImage string) []string {
-	d.tcpdumpContainerName = "ksniff-container-" + utils.GenerateRandomString(8)
+	tcpdumpContainerName := "ksniff-container-" + utils.GenerateRandomString(8)
+	d.tcpdumpContainerNames = append(d.tcpdumpContainerNames, tcpdumpContainerName)
 	d.socketPath = socketPath
 	tcpdumpCommand := fmt.Sprintf("tcpdump -i %s -U -w - %s", netInterface, filter)
 	shellScript := fmt.Sprintf(`
@@ -43,27 +48,40 @@ func (d *ContainerdBridge) BuildTcpdumpCommand(containerId *string, netInterface
     crictl pull %s >/dev/null
     netns=$(crictl inspect %s | jq '.info.runtimeSpec.linux.namespaces[] | select(.type == "network") | .path' | tr -d '"')
     exec chroot /host ctr -a ${CONTAINERD_SOCKET} run --rm --with-ns "network:${netns}" %s %s %s 
-    `, d.socketPath, tcpdumpImage, *containerId, tcpdumpImage, d.tcpdumpContainerName, tcpdumpCommand)
+    `, d.socketPath, tcpdumpImage, *containerId, tcpdumpImage, tcpdumpContainerName, tcpdumpCommand)
 	command := []string{"/bin/sh", "-c", shellScript}
 	return command
 }
 
 func (d *ContainerdBridge) BuildCleanupCommand() []string {
+	// Every container is killed even when one of them already exited
 	shellScript := fmt.Sprintf(`
-    set -ex
+    set -x
     export CONTAINERD_SOCKET="%s"
     export CONTAINERD_NAMESPACE="k8s.io"
-    export CONTAINER_ID="%s"
-    chroot /host ctr -a ${CONTAINERD_SOCKET} task kill -s SIGKILL ${CONTAINER_ID}
-    `, d.socketPath, d.tcpdumpContainerName)
+    status=0
+    for CONTAINER_ID in %s; do
+        chroot /host ctr -a ${CONTAINERD_SOCKET} task kill -s SIGKILL ${CONTAINER_ID} || status=1
+    done
+    exit ${status}
+    `, d.socketPath, strings.Join(d.tcpdumpContainerNames, " "))
 	command := []string{"/bin/sh", "-c", shellScript}
 	return command
 }
 
+// ctr creates the stdio fifos of the tcpdump container under the host root, which has to be writable.
+// The container itself is started by containerd, the helper pod only needs to chroot.
+func (d *ContainerdBridge) HelperRequirements(socketPath string) HelperRequirements {
+	return HelperRequirements{
+		Capabilities: []corev1.Capability{"SYS_CHROOT"},
+		HostPaths:    []HostPathMount{HostRootMount(false)},
+	}
+}
+
 func (d ContainerdBridge) GetDefaultImage() string {
 	return "docker.io/hamravesh/ksniff-helper:v3"
 }
 
 func (d *ContainerdBridge) GetDefaultTCPImage() string {
 	return "docker.io/maintained/tcpdump:latest"
-}
\ No newline at end of file
+}
@@ -0,0 +1,22 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerdCleanupCommand_SeveralInterfaces(t *testing.T) {
+	// given
+	bridge := NewContainerdBridge()
+	containerId := "container"
+	bridge.BuildTcpdumpCommand(&containerId, "eth0", "", nil, "/run/containerd/containerd.sock", bridge.GetDefaultTCPImage())
+	bridge.BuildTcpdumpCommand(&containerId, "net1", "", nil, "/run/containerd/containerd.sock", bridge.GetDefaultTCPImage())
+
+	// when
+	command := bridge.BuildCleanupCommand()
+
+	// then
+	assert.Len(t, bridge.tcpdumpContainerNames, 2)
+	assert.Contains(t, command[2], "for CONTAINER_ID in "+bridge.tcpdumpContainerNames[0]+" "+bridge.tcpdumpContainerNames[1]+"; do")
+}
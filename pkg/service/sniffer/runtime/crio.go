@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 )
 
 type CrioBridge struct {
@@ -60,6 +61,15 @@ func (c *CrioBridge) BuildCleanupCommand() []string {
 	return nil // No cleanup needed
 }
 
+// crictl runs from the read-only host root, tcpdump from the helper pod inside the target network namespace
+func (c *CrioBridge) HelperRequirements(socketPath string) HelperRequirements {
+	return HelperRequirements{
+		Capabilities: append(append([]corev1.Capability{}, nsenterCapabilities...), "SYS_CHROOT"),
+		HostPID:      true,
+		HostPaths:    []HostPathMount{HostRootMount(true)},
+	}
+}
+
 func (c *CrioBridge) GetDefaultImage() string {
 	return "maintained/tcpdump"
 }
@@ -0,0 +1,293 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"ksniff/utils"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// CustomBridgeConfig is the declarative description of a container runtime bridge,
+// loaded from a YAML file. Commands are text/template strings executed by /bin/sh
+// inside the privileged pod, see customBridgeTemplateData for the available fields.
+type CustomBridgeConfig struct {
+	Runtime             string `json:"runtime"`
+	DefaultImage        string `json:"defaultImage"`
+	DefaultTcpdumpImage string `json:"defaultTcpdumpImage"`
+	SocketPath          string `json:"socketPath"`
+	InspectCommand      string `json:"inspectCommand"`
+	PidJsonPath         string `json:"pidJsonPath"`
+	TcpdumpCommand      string `json:"tcpdumpCommand"`
+	CleanupCommand      string `json:"cleanupCommand"`
+	// The legacy privileged spec when missing, as the needs of the commands aren't known
+	HelperRequirements *HelperRequirements `json:"helperRequirements"`
+}
+
+type customBridgeTemplateData struct {
+	ContainerId   string
+	ContainerName string
+	Interface     string
+	Filter        string
+	Pid           string
+	SocketPath    string
+	TcpdumpImage  string
+}
+
+type CustomBridge struct {
+	config          CustomBridgeConfig
+	inspectTemplate *template.Template
+	tcpdumpTemplate *template.Template
+	cleanupTemplate *template.Template
+	// The data of every tcpdump command built, one per captured interface
+	commandData []customBridgeTemplateData
+}
+
+func NewCustomBridge(config CustomBridgeConfig) (*CustomBridge, error) {
+	if config.Runtime == "" {
+		return nil, errors.New("bridge runtime name is empty")
+	}
+
+	if config.TcpdumpCommand == "" {
+		return nil, errors.Errorf("bridge '%s' doesn't define a tcpdump command", config.Runtime)
+	}
+
+	if config.InspectCommand != "" && config.PidJsonPath == "" {
+		return nil, errors.Errorf("bridge '%s' defines an inspect command without a pid json path", config.Runtime)
+	}
+
+	bridge := &CustomBridge{config: config}
+
+	var err error
+
+	if bridge.tcpdumpTemplate, err = parseCommandTemplate("tcpdump", config.TcpdumpCommand); err != nil {
+		return nil, errors.Wrapf(err, "invalid tcpdump command in bridge '%s'", config.Runtime)
+	}
+
+	if bridge.inspectTemplate, err = parseCommandTemplate("inspect", config.InspectCommand); err != nil {
+		return nil, errors.Wrapf(err, "invalid inspect command in bridge '%s'", config.Runtime)
+	}
+
+	if bridge.cleanupTemplate, err = parseCommandTemplate("cleanup", config.CleanupCommand); err != nil {
+		return nil, errors.Wrapf(err, "invalid cleanup command in bridge '%s'", config.Runtime)
+	}
+
+	// Unknown fields only fail once executed, render every command once to report them right away
+	for _, tmpl := range []*template.Template{bridge.tcpdumpTemplate, bridge.inspectTemplate, bridge.cleanupTemplate} {
+		if _, err = renderCommand(tmpl, customBridgeTemplateData{}); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s command in bridge '%s'", tmpl.Name(), config.Runtime)
+		}
+	}
+
+	if config.PidJsonPath != "" {
+		if err = jsonpath.New("pid").Parse(config.PidJsonPath); err != nil {
+			return nil, errors.Wrapf(err, "invalid pid json path in bridge '%s'", config.Runtime)
+		}
+	}
+
+	return bridge, nil
+}
+
+func parseCommandTemplate(name string, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"quote": utils.ShellQuote}).
+		Parse(text)
+}
+
+func renderCommand(tmpl *template.Template, data customBridgeTemplateData) ([]string, error) {
+	if tmpl == nil {
+		return nil, nil
+	}
+
+	var script bytes.Buffer
+	if err := tmpl.Execute(&script, data); err != nil {
+		return nil, errors.Wrapf(err, "failed to render %s command", tmpl.Name())
+	}
+
+	return []string{"/bin/sh", "-c", script.String()}, nil
+}
+
+// buildCommand renders a command for the bridge interface, which has no room for an error
+func (c *CustomBridge) buildCommand(tmpl *template.Template, data customBridgeTemplateData) []string {
+	command, err := renderCommand(tmpl, data)
+	if err != nil {
+		log.WithError(err).Errorf("failed to build command of bridge: '%s'", c.config.Runtime)
+		return nil
+	}
+
+	return command
+}
+
+func (c *CustomBridge) NeedsPid() bool {
+	return c.inspectTemplate != nil
+}
+
+func (c *CustomBridge) BuildInspectCommand(containerId string) []string {
+	return c.buildCommand(c.inspectTemplate, customBridgeTemplateData{
+		ContainerId: containerId,
+		SocketPath:  c.config.SocketPath,
+	})
+}
+
+func (c *CustomBridge) ExtractPid(inspection string) (*string, error) {
+	var result interface{}
+
+	err := json.Unmarshal([]byte(inspection), &result)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jsonpath.New("pid")
+	if err = parser.Parse(c.config.PidJsonPath); err != nil {
+		return nil, err
+	}
+
+	values, err := parser.FindResults(result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting container PID from %s", c.config.Runtime)
+	}
+
+	if len(values) == 0 || len(values[0]) == 0 {
+		return nil, errors.Errorf("no PID found at '%s'", c.config.PidJsonPath)
+	}
+
+	var pid string
+
+	switch value := values[0][0].Interface().(type) {
+	case float64:
+		pid = fmt.Sprintf("%.0f", value)
+	case string:
+		pid = value
+	default:
+		return nil, errors.Errorf("unexpected PID value '%v' at '%s'", value, c.config.PidJsonPath)
+	}
+
+	return &pid, nil
+}
+
+func (c *CustomBridge) BuildTcpdumpCommand(containerId *string, netInterface string, filter string, pid *string, socketPath string, tcpdumpImage string) []string {
+	data := customBridgeTemplateData{
+		ContainerName: "ksniff-container-" + utils.GenerateRandomString(8),
+		Interface:     netInterface,
+		Filter:        filter,
+		SocketPath:    socketPath,
+		TcpdumpImage:  tcpdumpImage,
+	}
+
+	if containerId != nil {
+		data.ContainerId = *containerId
+	}
+
+	if pid != nil {
+		data.Pid = *pid
+	}
+
+	c.commandData = append(c.commandData, data)
+
+	return c.buildCommand(c.tcpdumpTemplate, data)
+}
+
+func (c *CustomBridge) BuildCleanupCommand() []string {
+	var scripts []string
+	for _, data := range c.commandData {
+		command := c.buildCommand(c.cleanupTemplate, data)
+		if command == nil {
+			return nil
+		}
+		scripts = append(scripts, command[2])
+	}
+
+	if len(scripts) == 0 {
+		return nil
+	}
+
+	return []string{"/bin/sh", "-c", strings.Join(scripts, "\n")}
+}
+
+func (c *CustomBridge) HelperRequirements(socketPath string) HelperRequirements {
+	if c.config.HelperRequirements == nil {
+		return LegacyHelperRequirements(socketPath)
+	}
+
+	return *c.config.HelperRequirements
+}
+
+func (c *CustomBridge) GetDefaultImage() string {
+	return c.config.DefaultImage
+}
+
+func (c *CustomBridge) GetDefaultTCPImage() string {
+	return c.config.DefaultTcpdumpImage
+}
+
+func (c *CustomBridge) GetDefaultSocketPath() string {
+	return c.config.SocketPath
+}
+
+// LoadCustomBridges registers a bridge for every YAML file found in the given directory.
+// A missing directory isn't considered an error.
+func LoadCustomBridges(directory string) error {
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		log.Debugf("custom bridges directory: '%s' doesn't exist", directory)
+		return nil
+	}
+
+	var paths []string
+
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(directory, pattern))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+
+	for _, path := range paths {
+		config, err := readCustomBridgeConfig(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed loading bridge from: '%s'", path)
+		}
+
+		// Validate once up-front so a broken file is reported at startup
+		if _, err = NewCustomBridge(config); err != nil {
+			return errors.Wrapf(err, "failed loading bridge from: '%s'", path)
+		}
+
+		log.Debugf("registering custom bridge: '%s' from: '%s'", config.Runtime, path)
+
+		RegisterContainerRuntimeBridge(config.Runtime, func() ContainerRuntimeBridge {
+			bridge, _ := NewCustomBridge(config)
+			return bridge
+		})
+	}
+
+	return nil
+}
+
+func readCustomBridgeConfig(path string) (CustomBridgeConfig, error) {
+	var config CustomBridgeConfig
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	err = yaml.UnmarshalStrict(content, &config)
+
+	return config, err
+}
@@ -0,0 +1,195 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	SYSBOX_BRIDGE_YAML = `
+runtime: sysbox
+defaultImage: example.com/ksniff-helper
+socketPath: /run/containerd/containerd.sock
+inspectCommand: chroot /host crictl inspect --output json {{.ContainerId}}
+pidJsonPath: "{.info.pid}"
+tcpdumpCommand: nsenter -n -t {{.Pid}} -- tcpdump -i {{.Interface}} -U -w - {{quote .Filter}}
+cleanupCommand: pkill -f {{.ContainerName}}
+`
+)
+
+func newSysboxBridge(t *testing.T) *CustomBridge {
+	bridge, err := NewCustomBridge(CustomBridgeConfig{
+		Runtime:        "sysbox",
+		SocketPath:     "/run/containerd/containerd.sock",
+		InspectCommand: "chroot /host crictl inspect --output json {{.ContainerId}}",
+		PidJsonPath:    "{.info.pid}",
+		TcpdumpCommand: "nsenter -n -t {{.Pid}} -- tcpdump -i {{.Interface}} -U -w - {{quote .Filter}}",
+		CleanupCommand: "pkill -f {{.ContainerName}}",
+	})
+	assert.Nil(t, err)
+
+	return bridge
+}
+
+func TestNewCustomBridge_MissingTcpdumpCommand(t *testing.T) {
+	// when
+	bridge, err := NewCustomBridge(CustomBridgeConfig{Runtime: "sysbox"})
+
+	// then
+	assert.Nil(t, bridge)
+	assert.NotNil(t, err)
+}
+
+func TestNewCustomBridge_InspectWithoutJsonPath(t *testing.T) {
+	// when
+	bridge, err := NewCustomBridge(CustomBridgeConfig{
+		Runtime:        "sysbox",
+		InspectCommand: "crictl inspect {{.ContainerId}}",
+		TcpdumpCommand: "tcpdump",
+	})
+
+	// then
+	assert.Nil(t, bridge)
+	assert.NotNil(t, err)
+}
+
+func TestNewCustomBridge_UnknownTemplateField(t *testing.T) {
+	// when
+	bridge, err := NewCustomBridge(CustomBridgeConfig{
+		Runtime:        "sysbox",
+		TcpdumpCommand: "tcpdump -i {{.Iface}}",
+	})
+
+	// then
+	assert.Nil(t, bridge)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid tcpdump command in bridge 'sysbox'")
+}
+
+func TestRenderCommand_ExecutionError(t *testing.T) {
+	// given
+	tmpl, err := parseCommandTemplate("tcpdump", "tcpdump {{index .Filter 3}}")
+	assert.Nil(t, err)
+
+	// when
+	command, err := renderCommand(tmpl, customBridgeTemplateData{})
+
+	// then
+	assert.Nil(t, command)
+	assert.NotNil(t, err)
+}
+
+func TestCustomBridge_ExtractPid(t *testing.T) {
+	// given
+	bridge := newSysboxBridge(t)
+
+	// when
+	result, err := bridge.ExtractPid(CRICTL_INSPECT_WITH_PID_118)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "827137", *result)
+}
+
+func TestCustomBridge_ExtractPidMissing(t *testing.T) {
+	// given
+	bridge := newSysboxBridge(t)
+
+	// when
+	result, err := bridge.ExtractPid(CRICTL_INSPECT_WITH_PID_117)
+
+	// then
+	assert.Nil(t, result)
+	assert.NotNil(t, err)
+}
+
+func TestCustomBridge_BuildTcpdumpCommand(t *testing.T) {
+	// given
+	bridge := newSysboxBridge(t)
+	containerId := "container"
+	pid := "1234"
+
+	// when
+	command := bridge.BuildTcpdumpCommand(&containerId, "eth0", "port 80", &pid, "/path", "")
+
+	// then
+	assert.Equal(t, []string{"/bin/sh", "-c", "nsenter -n -t 1234 -- tcpdump -i eth0 -U -w - 'port 80'"}, command)
+}
+
+func TestCustomBridge_BuildCleanupCommand(t *testing.T) {
+	// given
+	bridge := newSysboxBridge(t)
+	containerId := "container"
+	pid := "1234"
+
+	// when
+	beforeStart := bridge.BuildCleanupCommand()
+	bridge.BuildTcpdumpCommand(&containerId, "eth0", "", &pid, "/path", "")
+	afterStart := bridge.BuildCleanupCommand()
+
+	// then
+	assert.Nil(t, beforeStart)
+	assert.Equal(t, []string{"/bin/sh", "-c", "pkill -f " + bridge.commandData[0].ContainerName}, afterStart)
+}
+
+func TestLoadCustomBridges(t *testing.T) {
+	// given
+	directory, err := ioutil.TempDir("", "ksniff-bridges")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(directory, "sysbox.yaml"), []byte(SYSBOX_BRIDGE_YAML), 0644))
+	defer delete(registeredContainerRuntimeBridges, "sysbox")
+
+	// when
+	err = LoadCustomBridges(directory)
+
+	// then
+	assert.Nil(t, err)
+	assert.Contains(t, SupportedContainerRuntimes, "sysbox")
+	bridge := NewContainerRuntimeBridge("sysbox")
+	assert.IsType(t, &CustomBridge{}, bridge)
+	assert.Equal(t, "example.com/ksniff-helper", bridge.GetDefaultImage())
+}
+
+func TestLoadCustomBridges_UnknownTemplateField(t *testing.T) {
+	// given
+	directory, err := ioutil.TempDir("", "ksniff-bridges")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	content := strings.Replace(SYSBOX_BRIDGE_YAML, "{{.ContainerName}}", "{{.Container}}", 1)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(directory, "sysbox.yaml"), []byte(content), 0644))
+	defer delete(registeredContainerRuntimeBridges, "sysbox")
+
+	// when
+	err = LoadCustomBridges(directory)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid cleanup command in bridge 'sysbox'")
+	assert.NotContains(t, registeredContainerRuntimeBridges, "sysbox")
+}
+
+func TestLoadCustomBridges_MissingDirectory(t *testing.T) {
+	assert.Nil(t, LoadCustomBridges("/i-do-not-exist"))
+}
+
+func TestCustomBridge_BuildCleanupCommandSeveralInterfaces(t *testing.T) {
+	// given
+	bridge := newSysboxBridge(t)
+	containerId := "container"
+	pid := "1234"
+	bridge.BuildTcpdumpCommand(&containerId, "eth0", "", &pid, "/path", "")
+	bridge.BuildTcpdumpCommand(&containerId, "net1", "", &pid, "/path", "")
+
+	// when
+	command := bridge.BuildCleanupCommand()
+
+	// then
+	assert.Equal(t, []string{"/bin/sh", "-c", "pkill -f " + bridge.commandData[0].ContainerName + "\n" +
+		"pkill -f " + bridge.commandData[1].ContainerName}, command)
+}
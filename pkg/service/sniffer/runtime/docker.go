@@ -7,8 +7,9 @@ import (
 )
 
 type DockerBridge struct {
-	tcpdumpContainerName string
-	cleanupCommand       []string
+	// Every tcpdump container started, one per captured interface
+	tcpdumpContainerNames []string
+	socketPath            string
 }
 
 func NewDockerBridge() *DockerBridge {
@@ -28,22 +29,30 @@ func (d *DockerBridge) ExtractPid(inspection string) (*string, error) {
 }
 
 func (d *DockerBridge) BuildTcpdumpCommand(containerId *string, netInterface string, filter string, pid *string, socketPath string, tcpdumpImage string) []string {
-	d.tcpdumpContainerName = "ksniff-container-" + utils.GenerateRandomString(8)
-	containerNameFlag := fmt.Sprintf("--name=%s", d.tcpdumpContainerName)
+	tcpdumpContainerName := "ksniff-container-" + utils.GenerateRandomString(8)
+	d.tcpdumpContainerNames = append(d.tcpdumpContainerNames, tcpdumpContainerName)
+	d.socketPath = socketPath
+	containerNameFlag := fmt.Sprintf("--name=%s", tcpdumpContainerName)
 
 	command := []string{"docker", "--host", "unix://" + socketPath,
 		"run", "--rm", "--log-driver", "none", containerNameFlag,
 		fmt.Sprintf("--net=container:%s", *containerId), tcpdumpImage, "-i",
 		netInterface, "-U", "-w", "-", filter}
 
-	d.cleanupCommand = []string{"docker", "--host", "unix://" + socketPath,
-		"rm", "-f", d.tcpdumpContainerName}
-
 	return command
 }
 
 func (d *DockerBridge) BuildCleanupCommand() []string {
-	return d.cleanupCommand
+	if len(d.tcpdumpContainerNames) == 0 {
+		return nil
+	}
+
+	return append([]string{"docker", "--host", "unix://" + d.socketPath, "rm", "-f"}, d.tcpdumpContainerNames...)
+}
+
+// The tcpdump container is started by the docker daemon, the helper pod only talks to its socket
+func (d *DockerBridge) HelperRequirements(socketPath string) HelperRequirements {
+	return HelperRequirements{HostPaths: []HostPathMount{SocketMount(socketPath)}}
 }
 
 func (d *DockerBridge) GetDefaultImage() string {
@@ -25,7 +25,7 @@ func TestPrivilegedPodName(t *testing.T) {
 	var path = "/path"
 	var tcpdumpImage = bridge.GetDefaultTCPImage()
 	bridge.BuildTcpdumpCommand(&containerId, netInterface, filter, &pid, path, tcpdumpImage)
-	assert.NotEqual(t, "", bridge.tcpdumpContainerName, "tcpdumpContainerName should have been set")
+	assert.Len(t, bridge.tcpdumpContainerNames, 1, "tcpdumpContainerNames should have been set")
 }
 
 func TestCleanupCommand(t *testing.T) {
@@ -38,7 +38,23 @@ func TestCleanupCommand(t *testing.T) {
 	var tcpdumpImage = bridge.GetDefaultTCPImage()
 	bridge.BuildTcpdumpCommand(&containerId, netInterface, filter, &pid, socketPath, tcpdumpImage)
 	assert.Equal(t,
-		[]string{"docker", "--host", "unix://" + socketPath, "rm", "-f", bridge.tcpdumpContainerName},
+		[]string{"docker", "--host", "unix://" + socketPath, "rm", "-f", bridge.tcpdumpContainerNames[0]},
 		bridge.BuildCleanupCommand(),
 		"container cleanup command doesn't match")
 }
+
+func TestCleanupCommand_SeveralInterfaces(t *testing.T) {
+	bridge := NewDockerBridge()
+	var containerId = "container"
+	var socketPath = "/path"
+	bridge.BuildTcpdumpCommand(&containerId, "eth0", "", nil, socketPath, bridge.GetDefaultTCPImage())
+	bridge.BuildTcpdumpCommand(&containerId, "net1", "", nil, socketPath, bridge.GetDefaultTCPImage())
+	assert.Equal(t,
+		[]string{"docker", "--host", "unix://" + socketPath, "rm", "-f", bridge.tcpdumpContainerNames[0], bridge.tcpdumpContainerNames[1]},
+		bridge.BuildCleanupCommand(),
+		"every tcpdump container should be removed")
+}
+
+func TestCleanupCommand_NothingStarted(t *testing.T) {
+	assert.Nil(t, NewDockerBridge().BuildCleanupCommand())
+}
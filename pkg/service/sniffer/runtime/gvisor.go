@@ -0,0 +1,51 @@
+package runtime
+
+// GvisorBridge captures pods sandboxed by gVisor (runsc).
+// The sentry implements its own userspace netstack, so a tcpdump running inside the sandbox
+// can't see the pod traffic. Instead, the network namespace holding the sandbox's veth is
+// entered from the host side, using the PID of the sandbox process.
+type GvisorBridge struct {
+	crio *CrioBridge
+}
+
+func NewGvisorBridge() *GvisorBridge {
+	return &GvisorBridge{crio: NewCrioBridge()}
+}
+
+func (g *GvisorBridge) NeedsPid() bool {
+	return true
+}
+
+func (g *GvisorBridge) BuildInspectCommand(containerId string) []string {
+	return []string{"chroot", "/host", "crictl", "inspect",
+		"--output", "json", containerId}
+}
+
+func (g *GvisorBridge) ExtractPid(inspection string) (*string, error) {
+	// runsc is a CRI runtime handler, crictl reports the sandbox PID the same way CRI-O does
+	return g.crio.ExtractPid(inspection)
+}
+
+func (g *GvisorBridge) BuildTcpdumpCommand(containerId *string, netInterface string, filter string, pid *string, socketPath string, tcpdumpImage string) []string {
+	return []string{"nsenter", "-n", "-t", *pid, "--", "tcpdump", "-i", netInterface, "-U", "-w", "-", filter}
+}
+
+func (g *GvisorBridge) BuildCleanupCommand() []string {
+	return nil // No cleanup needed
+}
+
+func (g *GvisorBridge) HelperRequirements(socketPath string) HelperRequirements {
+	return g.crio.HelperRequirements(socketPath)
+}
+
+func (g *GvisorBridge) GetDefaultImage() string {
+	return "maintained/tcpdump"
+}
+
+func (g *GvisorBridge) GetDefaultTCPImage() string {
+	return ""
+}
+
+func (g *GvisorBridge) GetDefaultSocketPath() string {
+	return "/run/containerd/containerd.sock"
+}
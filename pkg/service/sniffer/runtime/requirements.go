@@ -0,0 +1,57 @@
+package runtime
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HostPathMount mounts a host path into the helper pod
+type HostPathMount struct {
+	Name      string              `json:"name"`
+	HostPath  string              `json:"hostPath"`
+	MountPath string              `json:"mountPath"`
+	ReadOnly  bool                `json:"readOnly"`
+	Type      corev1.HostPathType `json:"type"`
+}
+
+// HelperRequirements is the minimum the helper pod needs to run the commands of a bridge,
+// the pod spec is generated from it so its footprint can be reviewed per runtime.
+type HelperRequirements struct {
+	// Every capability and device of the host, only for bridges starting containers through the runtime
+	Privileged   bool                `json:"privileged"`
+	Capabilities []corev1.Capability `json:"capabilities"`
+	HostPID      bool                `json:"hostPID"`
+	HostNetwork  bool                `json:"hostNetwork"`
+	HostPaths    []HostPathMount     `json:"hostPaths"`
+}
+
+// Capabilities of entering the network namespace of another process and capturing in it
+var nsenterCapabilities = []corev1.Capability{"SYS_ADMIN", "SYS_PTRACE", "NET_RAW", "NET_ADMIN"}
+
+// HostRootMount mounts the host root filesystem at /host
+func HostRootMount(readOnly bool) HostPathMount {
+	return HostPathMount{Name: "host", HostPath: "/", MountPath: "/host", ReadOnly: readOnly, Type: corev1.HostPathDirectory}
+}
+
+// SocketMountName is the name of the container runtime socket volume
+const SocketMountName = "container-socket"
+
+// SocketMount mounts the container runtime socket at the same path
+func SocketMount(socketPath string) HostPathMount {
+	return HostPathMount{Name: SocketMountName, HostPath: socketPath, MountPath: socketPath, ReadOnly: true, Type: corev1.HostPathSocket}
+}
+
+// LegacyHelperRequirements returns what every helper pod got before bridges declared their requirements:
+// privileged, sharing the host PID namespace, with the host root mounted read-write and the runtime socket.
+func LegacyHelperRequirements(socketPath string) HelperRequirements {
+	requirements := HelperRequirements{
+		Privileged: true,
+		HostPID:    true,
+		HostPaths:  []HostPathMount{HostRootMount(false)},
+	}
+
+	if socketPath != "" {
+		requirements.HostPaths = append(requirements.HostPaths, SocketMount(socketPath))
+	}
+
+	return requirements
+}
@@ -0,0 +1,86 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestLegacyHelperRequirements(t *testing.T) {
+	// when
+	requirements := LegacyHelperRequirements("/var/run/docker.sock")
+
+	// then
+	assert.True(t, requirements.Privileged)
+	assert.True(t, requirements.HostPID)
+	assert.Equal(t, []HostPathMount{HostRootMount(false), SocketMount("/var/run/docker.sock")}, requirements.HostPaths)
+}
+
+func TestLegacyHelperRequirements_NoSocket(t *testing.T) {
+	// when
+	requirements := LegacyHelperRequirements("")
+
+	// then
+	assert.Equal(t, []HostPathMount{HostRootMount(false)}, requirements.HostPaths)
+}
+
+func TestHelperRequirements_NoBridgeIsPrivileged(t *testing.T) {
+	for _, runtimeName := range []string{"docker", "cri-o", "containerd"} {
+		// when
+		requirements := NewContainerRuntimeBridge(runtimeName).HelperRequirements("/run/runtime.sock")
+
+		// then
+		assert.False(t, requirements.Privileged, runtimeName)
+	}
+}
+
+func TestDockerBridge_HelperRequirements(t *testing.T) {
+	// when
+	requirements := NewDockerBridge().HelperRequirements("/var/run/docker.sock")
+
+	// then
+	assert.Equal(t, HelperRequirements{HostPaths: []HostPathMount{SocketMount("/var/run/docker.sock")}}, requirements)
+}
+
+func TestCrioBridge_HelperRequirements(t *testing.T) {
+	// when
+	requirements := NewCrioBridge().HelperRequirements("/var/run/crio/crio.sock")
+
+	// then
+	assert.True(t, requirements.HostPID)
+	assert.Contains(t, requirements.Capabilities, corev1.Capability("SYS_ADMIN"))
+	assert.Contains(t, requirements.Capabilities, corev1.Capability("SYS_CHROOT"))
+	assert.Equal(t, []HostPathMount{HostRootMount(true)}, requirements.HostPaths)
+	assert.Len(t, nsenterCapabilities, 4, "nsenter capabilities aren't shared with the cri-o requirements")
+}
+
+func TestCustomBridge_HelperRequirements(t *testing.T) {
+	// given
+	config := CustomBridgeConfig{}
+	assert.Nil(t, yaml.UnmarshalStrict([]byte(SYSBOX_BRIDGE_YAML+`
+helperRequirements:
+  capabilities: [SYS_ADMIN]
+  hostPID: true
+`), &config))
+	bridge, err := NewCustomBridge(config)
+	assert.Nil(t, err)
+
+	// when
+	requirements := bridge.HelperRequirements(config.SocketPath)
+
+	// then
+	assert.Equal(t, HelperRequirements{Capabilities: []corev1.Capability{"SYS_ADMIN"}, HostPID: true}, requirements)
+}
+
+func TestCustomBridge_HelperRequirementsDefaultsToLegacy(t *testing.T) {
+	// given
+	bridge := newSysboxBridge(t)
+
+	// when
+	requirements := bridge.HelperRequirements("/run/containerd/containerd.sock")
+
+	// then
+	assert.Equal(t, LegacyHelperRequirements("/run/containerd/containerd.sock"), requirements)
+}
@@ -17,9 +17,33 @@ type ContainerRuntimeBridge interface {
 	GetDefaultImage() string
 	GetDefaultTCPImage() string
 	GetDefaultSocketPath() string
+	// The least privileges the helper pod running the bridge commands needs
+	HelperRequirements(socketPath string) HelperRequirements
+}
+
+type ContainerRuntimeBridgeFactory func() ContainerRuntimeBridge
+
+var registeredContainerRuntimeBridges = map[string]ContainerRuntimeBridgeFactory{}
+
+// RegisterContainerRuntimeBridge makes a bridge available under the given runtime prefix,
+// taking precedence over the built-in bridge of the same name.
+func RegisterContainerRuntimeBridge(runtimeName string, factory ContainerRuntimeBridgeFactory) {
+	registeredContainerRuntimeBridges[runtimeName] = factory
+
+	for _, supportedRuntime := range SupportedContainerRuntimes {
+		if supportedRuntime == runtimeName {
+			return
+		}
+	}
+
+	SupportedContainerRuntimes = append(SupportedContainerRuntimes, runtimeName)
 }
 
 func NewContainerRuntimeBridge(runtimeName string) ContainerRuntimeBridge {
+	if factory, ok := registeredContainerRuntimeBridges[runtimeName]; ok {
+		return factory()
+	}
+
 	switch runtimeName {
 	case "docker":
 		return NewDockerBridge()
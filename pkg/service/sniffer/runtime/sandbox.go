@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RuntimeClass handlers running pods inside a sandbox that has its own network stack or kernel
+var sandboxRuntimeHandlerPrefixes = []string{
+	"runsc",
+	"gvisor",
+	"kata",
+	"firecracker",
+}
+
+// RuntimeClass handlers running pods inside a VM, whose traffic is only visible on the host side of the pod veth
+var hostSideCaptureRuntimeHandlerPrefixes = []string{
+	"kata",
+	"firecracker",
+}
+
+var SupportedSandboxRuntimeHandlers = []string{
+	"runsc",
+	"gvisor",
+}
+
+func IsSandboxRuntimeHandler(handler string) bool {
+	for _, prefix := range sandboxRuntimeHandlerPrefixes {
+		if strings.HasPrefix(handler, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func RequiresHostSideCapture(handler string) bool {
+	for _, prefix := range hostSideCaptureRuntimeHandlerPrefixes {
+		if strings.HasPrefix(handler, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func NewSandboxRuntimeBridge(handler string) (ContainerRuntimeBridge, error) {
+	for _, supported := range SupportedSandboxRuntimeHandlers {
+		if strings.HasPrefix(handler, supported) {
+			return NewGvisorBridge(), nil
+		}
+	}
+
+	if RequiresHostSideCapture(handler) {
+		return nil, errors.Errorf("sandbox runtime handler '%s' runs pods inside a VM, which the privileged mode can't enter. "+
+			"please capture on the host side of the pod veth (--host-veth)", handler)
+	}
+
+	return nil, errors.Errorf("sandbox runtime handler '%s' isn't supported. Supported sandbox runtime handlers are: %v",
+		handler, SupportedSandboxRuntimeHandlers)
+}
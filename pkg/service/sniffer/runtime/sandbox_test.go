@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSandboxRuntimeHandler(t *testing.T) {
+	assert.True(t, IsSandboxRuntimeHandler("runsc"))
+	assert.True(t, IsSandboxRuntimeHandler("kata-qemu"))
+	assert.False(t, IsSandboxRuntimeHandler("runc"))
+	assert.False(t, IsSandboxRuntimeHandler(""))
+}
+
+func TestNewSandboxRuntimeBridge_Gvisor(t *testing.T) {
+	bridge, err := NewSandboxRuntimeBridge("runsc")
+	assert.Nil(t, err)
+	assert.IsType(t, &GvisorBridge{}, bridge)
+}
+
+func TestNewSandboxRuntimeBridge_Unsupported(t *testing.T) {
+	bridge, err := NewSandboxRuntimeBridge("kata-fc")
+	assert.Nil(t, bridge)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "kata-fc")
+	assert.Contains(t, err.Error(), "--host-veth")
+}
+
+func TestGvisorBridge_BuildTcpdumpCommand(t *testing.T) {
+	bridge := NewGvisorBridge()
+	containerId := "container"
+	pid := "4242"
+
+	command := bridge.BuildTcpdumpCommand(&containerId, "eth0", "port 53", &pid, bridge.GetDefaultSocketPath(), "")
+
+	assert.Equal(t, []string{"nsenter", "-n", "-t", "4242", "--", "tcpdump", "-i", "eth0", "-U", "-w", "-", "port 53"}, command)
+}
+
+func TestRequiresHostSideCapture(t *testing.T) {
+	assert.True(t, RequiresHostSideCapture("kata-qemu"))
+	assert.False(t, RequiresHostSideCapture("runsc"))
+	assert.False(t, RequiresHostSideCapture(""))
+}
@@ -1,17 +1,38 @@
 package sniffer
 
 import (
+	"context"
+	"fmt"
 	"io"
 )
 
 type SnifferService interface {
 	// Perform all actions required for starting the remote sniffing
-	Setup() error
+	Setup(ctx context.Context) error
 
-	// Rollback actions performed during the Setup phase
-	Cleanup() error
+	// Rollback actions performed during the Setup phase,
+	// the given context should outlive the one used for the capture.
+	Cleanup(ctx context.Context) error
 
 	// Start remote sniffing
-	// write remote capture output to the given io writer.
-	Start(stdOut io.Writer) error
+	// write remote capture output to the given io writer, until the context is done.
+	Start(ctx context.Context, stdOut io.Writer) error
+}
+
+// InterfaceSnifferService captures on the given interface instead of the one of the settings,
+// several captures may run at once after a single setup.
+type InterfaceSnifferService interface {
+	SnifferService
+
+	StartOnInterface(ctx context.Context, netInterface string, stdOut io.Writer) error
+}
+
+// CaptureExitError is returned when the remote capture command exits with a failure on its own, e.g. on a bad
+// filter or a missing interface, as opposed to the capture stream being lost on the way.
+type CaptureExitError struct {
+	ExitCode int
+}
+
+func (c *CaptureExitError) Error() string {
+	return fmt.Sprintf("executing sniffer failed, exit code: '%d'", c.ExitCode)
 }
@@ -1,53 +1,131 @@
 package sniffer
 
 import (
+	"context"
 	"io"
 	"ksniff/kube"
 	"ksniff/pkg/config"
+	"ksniff/pkg/service/sniffer/runtime"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
 )
 
+const uploadHelperDefaultImage = "busybox"
+
+// Writing through /proc/<pid>/root of the target container needs its process to be visible and traceable
+var uploadHelperRequirements = runtime.HelperRequirements{
+	HostPID:      true,
+	Capabilities: []v1.Capability{"SYS_PTRACE"},
+}
+
 type StaticTcpdumpSnifferService struct {
-	settings             *config.KsniffSettings
-	kubernetesApiService kube.KubernetesApiService
+	settings                  *config.KsniffSettings
+	kubernetesApiService      kube.KubernetesApiService
+	uploadHelperPod           *v1.Pod
+	uploadHelperContainerName string
+	compression               string
 }
 
 func NewUploadTcpdumpRemoteSniffingService(options *config.KsniffSettings, service kube.KubernetesApiService) SnifferService {
-	return &StaticTcpdumpSnifferService{settings: options, kubernetesApiService: service}
+	return &StaticTcpdumpSnifferService{settings: options, kubernetesApiService: service, uploadHelperContainerName: "ksniff-upload"}
 }
 
-func (u *StaticTcpdumpSnifferService) Setup() error {
+func (u *StaticTcpdumpSnifferService) Setup(ctx context.Context) error {
 	log.Infof("uploading static tcpdump binary from: '%s' to: '%s'",
 		u.settings.UserSpecifiedLocalTcpdumpPath, u.settings.UserSpecifiedRemoteTcpdumpPath)
 
-	err := u.kubernetesApiService.UploadFile(u.settings.UserSpecifiedLocalTcpdumpPath,
+	err := u.kubernetesApiService.UploadFile(ctx, u.settings.UserSpecifiedLocalTcpdumpPath,
 		u.settings.UserSpecifiedRemoteTcpdumpPath, u.settings.UserSpecifiedPodName, u.settings.UserSpecifiedContainer)
 
+	if errors.Cause(err) == kube.ErrNoUploadStrategy {
+		log.Warnf("container: '%s' has no tool to receive the upload, falling back to a privileged upload pod on node: '%s' "+
+			"sharing the host PID namespace with capabilities: %v", u.settings.UserSpecifiedContainer,
+			u.settings.DetectedPodNodeName, uploadHelperRequirements.Capabilities)
+		err = u.uploadViaHelperPod(ctx)
+	}
+
 	if err != nil {
-		log.WithError(err).Errorf("failed uploading static tcpdump binary to container, please verify the remote container has tar installed")
+		log.WithError(err).Errorf("failed uploading static tcpdump binary to container")
 		return err
 	}
 
 	log.Info("tcpdump uploaded successfully")
 
+	u.compression = resolveCompression(ctx, u.kubernetesApiService, u.settings.UserSpecifiedPodName, u.settings.UserSpecifiedContainer, u.settings.UserSpecifiedCompression)
+
 	return nil
 }
 
-func (u *StaticTcpdumpSnifferService) Cleanup() error {
+// uploadViaHelperPod writes tcpdump through the target container root filesystem
+// from a privileged pod on the same node, the last resort for images without any usable tool.
+func (u *StaticTcpdumpSnifferService) uploadViaHelperPod(ctx context.Context) error {
+	var err error
+
+	image := u.settings.Image
+	if u.settings.UseDefaultImage {
+		image = uploadHelperDefaultImage
+	}
+
+	u.uploadHelperPod, err = u.kubernetesApiService.CreatePrivilegedPod(
+		ctx,
+		u.settings.DetectedPodNodeName,
+		u.uploadHelperContainerName,
+		image,
+		uploadHelperRequirements,
+		u.settings.UserSpecifiedPodCreateTimeout,
+		u.settings.UserSpecifiedServiceAccount,
+		u.settings.PrivilegedPodOptions,
+	)
+	if err != nil {
+		return err
+	}
+
+	return u.kubernetesApiService.UploadFileViaHelperPod(ctx, u.settings.UserSpecifiedLocalTcpdumpPath,
+		u.settings.UserSpecifiedRemoteTcpdumpPath, u.uploadHelperPod.Name, u.uploadHelperContainerName,
+		u.settings.UserSpecifiedPodName, u.settings.UserSpecifiedContainer, u.settings.DetectedContainerId)
+}
+
+func (u *StaticTcpdumpSnifferService) Cleanup(ctx context.Context) error {
+	if u.uploadHelperPod == nil {
+		return nil
+	}
+
+	log.Infof("removing pod: '%s'", u.uploadHelperPod.Name)
+
+	err := u.kubernetesApiService.DeletePod(ctx, u.uploadHelperPod.Name)
+	if err != nil {
+		log.WithError(err).Errorf("failed to remove pod: '%s", u.uploadHelperPod.Name)
+		return err
+	}
+
+	log.Infof("pod: '%s' removed successfully", u.uploadHelperPod.Name)
+
 	return nil
 }
 
-func (u *StaticTcpdumpSnifferService) Start(stdOut io.Writer) error {
-	log.Info("start sniffing on remote container")
+func (u *StaticTcpdumpSnifferService) Start(ctx context.Context, stdOut io.Writer) error {
+	return u.StartOnInterface(ctx, u.settings.UserSpecifiedInterface, stdOut)
+}
+
+func (u *StaticTcpdumpSnifferService) StartOnInterface(ctx context.Context, netInterface string, stdOut io.Writer) error {
+	log.Infof("start sniffing on remote container, interface: '%s'", netInterface)
 
-	command := []string{u.settings.UserSpecifiedRemoteTcpdumpPath, "-i", u.settings.UserSpecifiedInterface,
+	command := []string{u.settings.UserSpecifiedRemoteTcpdumpPath, "-i", netInterface,
 		"-U", "-w", "-", u.settings.UserSpecifiedFilter}
 
-	exitCode, err := u.kubernetesApiService.ExecuteCommand(u.settings.UserSpecifiedPodName, u.settings.UserSpecifiedContainer, command, stdOut)
-	if err != nil || exitCode != 0 {
-		return errors.Errorf("executing sniffer failed, exit code: '%d'", exitCode)
+	exitCode, err := executeCapture(u.compression, command, stdOut, func(command []string, stdOut io.Writer) (int, error) {
+		return u.kubernetesApiService.ExecuteCommand(ctx, u.settings.UserSpecifiedPodName, u.settings.UserSpecifiedContainer, command, stdOut)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if exitCode != 0 {
+		return &CaptureExitError{ExitCode: exitCode}
+	}
+	if err != nil {
+		return errors.Wrap(err, "executing sniffer failed")
 	}
 
 	log.Infof("done sniffing on remote container")
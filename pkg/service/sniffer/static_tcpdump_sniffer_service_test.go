@@ -0,0 +1,224 @@
+package sniffer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ksniff/kube"
+	"ksniff/kube/fakeexec"
+	"ksniff/pkg/config"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newStaticSnifferService(t *testing.T, compression string) (*fakeexec.Server, SnifferService, func()) {
+	dir, err := ioutil.TempDir("", "ksniff-static")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "tmp"), 0755))
+
+	localTcpdumpPath := filepath.Join(dir, "static-tcpdump")
+	assert.Nil(t, ioutil.WriteFile(localTcpdumpPath, []byte("static tcpdump"), 0755))
+
+	server := fakeexec.NewServer(dir)
+
+	settings := config.NewKsniffSettings()
+	settings.UserSpecifiedPodName = "pod"
+	settings.UserSpecifiedContainer = "container"
+	settings.UserSpecifiedInterface = "any"
+	settings.UserSpecifiedLocalTcpdumpPath = localTcpdumpPath
+	settings.UserSpecifiedRemoteTcpdumpPath = "/tmp/static-tcpdump"
+	settings.UserSpecifiedPodCreateTimeout = time.Second
+	settings.UserSpecifiedCompression = compression
+
+	kubernetesApiService := kube.NewKubernetesApiService(server.Clientset(fake.NewSimpleClientset()),
+		server.RestConfig(), "default", kube.ExecTransportWebsocket, nil)
+
+	return server, NewUploadTcpdumpRemoteSniffingService(settings, kubernetesApiService), func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func countCommands(commands []string, prefix string) int {
+	count := 0
+	for _, command := range commands {
+		if strings.HasPrefix(command, prefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestStaticTcpdumpSnifferService_UploadAndCapture(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	pcap := singlePacketPcap("packet")
+	server.ServeCapture("/tmp/static-tcpdump", pcap)
+	output := new(bytes.Buffer)
+
+	// when
+	setupErr := service.Setup(context.Background())
+	startErr := service.Start(context.Background(), output)
+
+	// then
+	assert.Nil(t, setupErr)
+	assert.Nil(t, startErr)
+	assert.Equal(t, pcap, output.Bytes())
+	content, err := ioutil.ReadFile(server.Path("/tmp/static-tcpdump"))
+	assert.Nil(t, err)
+	assert.Equal(t, "static tcpdump", string(content))
+	assert.Contains(t, server.Commands(), "tar -xzf - -C /tmp")
+	assert.Contains(t, server.Commands(), "/tmp/static-tcpdump -i any -U -w - ")
+	assert.Nil(t, service.Cleanup(context.Background()))
+}
+
+func TestStaticTcpdumpSnifferService_SkipsMatchingUpload(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	assert.Nil(t, service.Setup(context.Background()))
+
+	// when
+	err := service.Setup(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countCommands(server.Commands(), "tar -x"))
+}
+
+func TestStaticTcpdumpSnifferService_ReplacesMismatchingUpload(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	assert.Nil(t, ioutil.WriteFile(server.Path("/tmp/static-tcpdump"), []byte("truncated"), 0755))
+
+	// when
+	err := service.Setup(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countCommands(server.Commands(), "tar -x"))
+	content, _ := ioutil.ReadFile(server.Path("/tmp/static-tcpdump"))
+	assert.Equal(t, "static tcpdump", string(content))
+}
+
+// withoutChecksumTools makes the container lack every checksum tool, as minimal images do
+func withoutChecksumTools(server *fakeexec.Server) {
+	for _, command := range []string{"sha256sum", "md5sum", "busybox"} {
+		server.Handle(command, func(cmd *fakeexec.Command) int {
+			return 127
+		})
+	}
+}
+
+func TestStaticTcpdumpSnifferService_ReplacesTruncatedUploadWithoutChecksumTools(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	withoutChecksumTools(server)
+	assert.Nil(t, ioutil.WriteFile(server.Path("/tmp/static-tcpdump"), []byte("static"), 0755))
+
+	// when
+	err := service.Setup(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countCommands(server.Commands(), "tar -x"))
+	content, _ := ioutil.ReadFile(server.Path("/tmp/static-tcpdump"))
+	assert.Equal(t, "static tcpdump", string(content))
+}
+
+func TestStaticTcpdumpSnifferService_KeepsSameSizeUploadWithoutChecksumTools(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	withoutChecksumTools(server)
+	assert.Nil(t, ioutil.WriteFile(server.Path("/tmp/static-tcpdump"), []byte("static tcpdump"), 0755))
+
+	// when
+	err := service.Setup(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 0, countCommands(server.Commands(), "tar -x"))
+}
+
+func TestStaticTcpdumpSnifferService_ReplacesUnverifiableUpload(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	withoutChecksumTools(server)
+	server.Handle("wc", func(cmd *fakeexec.Command) int {
+		return 127
+	})
+	assert.Nil(t, ioutil.WriteFile(server.Path("/tmp/static-tcpdump"), []byte("static tcpdump"), 0755))
+
+	// when
+	err := service.Setup(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countCommands(server.Commands(), "tar -x"))
+}
+
+func TestStaticTcpdumpSnifferService_FailedUploadDoesNotFallBackToHelperPod(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	for _, command := range []string{"tar", "sh"} {
+		server.Handle(command, func(cmd *fakeexec.Command) int {
+			return 2
+		})
+	}
+
+	// when
+	err := service.Setup(context.Background())
+
+	// then
+	assert.Equal(t, kube.ErrUploadFailed, errors.Cause(err))
+	assert.Nil(t, service.Cleanup(context.Background()), "no upload pod was created")
+}
+
+func TestStaticTcpdumpSnifferService_CompressorUnavailable(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionGzip)
+	defer cleanup()
+	pcap := singlePacketPcap("packet")
+	server.ServeCapture("/tmp/static-tcpdump", pcap)
+	output := new(bytes.Buffer)
+	assert.Nil(t, service.Setup(context.Background()))
+
+	// when
+	err := service.Start(context.Background(), output)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, pcap, output.Bytes(), "the capture falls back to no compression")
+}
+
+func TestStaticTcpdumpSnifferService_CaptureFailure(t *testing.T) {
+	// given
+	server, service, cleanup := newStaticSnifferService(t, CompressionNone)
+	defer cleanup()
+	server.Handle("/tmp/static-tcpdump", func(cmd *fakeexec.Command) int {
+		return 1
+	})
+	assert.Nil(t, service.Setup(context.Background()))
+
+	// when
+	err := service.Start(context.Background(), new(bytes.Buffer))
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "exit code: '1'")
+}
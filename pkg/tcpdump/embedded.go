@@ -0,0 +1,16 @@
+//go:build embed_tcpdump
+// +build embed_tcpdump
+
+package tcpdump
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed binaries
+var embeddedBinariesRoot embed.FS
+
+func init() {
+	embeddedBinaries, _ = fs.Sub(embeddedBinariesRoot, "binaries")
+}
@@ -0,0 +1,113 @@
+package tcpdump
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ksniff/utils"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const binaryNamePrefix = "static-tcpdump-"
+
+// Compressed static tcpdump binaries, one per architecture, only set when built with the embed_tcpdump tag
+var embeddedBinaries fs.FS
+
+var ErrNotEmbedded = errors.New("static tcpdump binaries aren't embedded in this build")
+
+// ExtractEmbeddedBinary writes the embedded static tcpdump built for the given architecture
+// to the user cache directory, and returns its path. Previously extracted binaries are reused
+// as long as their sha256 matches.
+func ExtractEmbeddedBinary(architecture string) (string, error) {
+	if embeddedBinaries == nil {
+		return "", ErrNotEmbedded
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return extractBinary(embeddedBinaries, architecture, filepath.Join(cacheDir, "ksniff"))
+}
+
+func extractBinary(binaries fs.FS, architecture string, cacheDir string) (string, error) {
+	binaryName := binaryNamePrefix + architecture
+
+	checksumFile, err := fs.ReadFile(binaries, binaryName+".sha256")
+	if err != nil {
+		return "", errors.Wrapf(err, "no embedded static tcpdump for architecture: '%s'", architecture)
+	}
+
+	checksumFields := strings.Fields(string(checksumFile))
+	if len(checksumFields) == 0 {
+		return "", errors.Errorf("empty checksum for embedded binary: '%s'", binaryName)
+	}
+	expectedChecksum := checksumFields[0]
+
+	binaryDir := filepath.Join(cacheDir, expectedChecksum)
+	binaryPath := filepath.Join(binaryDir, binaryName)
+
+	if checksum, err := utils.FileSha256(binaryPath); err == nil && checksum == expectedChecksum {
+		log.Debugf("using previously extracted tcpdump binary at: '%s'", binaryPath)
+		return binaryPath, nil
+	}
+
+	log.Infof("extracting embedded tcpdump binary to: '%s'", binaryPath)
+
+	if err = os.MkdirAll(binaryDir, 0755); err != nil {
+		return "", err
+	}
+
+	compressed, err := binaries.Open(binaryName + ".gz")
+	if err != nil {
+		return "", err
+	}
+	defer compressed.Close()
+
+	reader, err := gzip.NewReader(compressed)
+	if err != nil {
+		return "", err
+	}
+
+	// Extract next to the final path, so the rename below is atomic
+	tempFile, err := ioutil.TempFile(binaryDir, binaryName)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, hash), reader)
+	closeErr := tempFile.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != expectedChecksum {
+		return "", errors.Errorf("embedded binary: '%s' checksum mismatch, expected: '%s', got: '%s'",
+			binaryName, expectedChecksum, checksum)
+	}
+
+	if err = os.Chmod(tempFile.Name(), 0755); err != nil {
+		return "", err
+	}
+
+	if err = os.Rename(tempFile.Name(), binaryPath); err != nil {
+		return "", err
+	}
+
+	return binaryPath, nil
+}
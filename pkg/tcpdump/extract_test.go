@@ -0,0 +1,99 @@
+package tcpdump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBinariesFS(t *testing.T, content []byte, checksum string) fstest.MapFS {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(content)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	return fstest.MapFS{
+		"static-tcpdump-arm64.gz":     {Data: compressed.Bytes()},
+		"static-tcpdump-arm64.sha256": {Data: []byte(checksum + "  static-tcpdump-arm64\n")},
+	}
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtractBinary_Valid(t *testing.T) {
+	// given
+	cacheDir, err := ioutil.TempDir("", "ksniff-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+	content := []byte("tcpdump")
+	binaries := newBinariesFS(t, content, sha256Hex(content))
+
+	// when
+	path, err := extractBinary(binaries, "arm64", cacheDir)
+
+	// then
+	assert.Nil(t, err)
+	extracted, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, content, extracted)
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func TestExtractBinary_ReusesCachedBinary(t *testing.T) {
+	// given
+	cacheDir, err := ioutil.TempDir("", "ksniff-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+	content := []byte("tcpdump")
+	binaries := newBinariesFS(t, content, sha256Hex(content))
+	firstPath, err := extractBinary(binaries, "arm64", cacheDir)
+	assert.Nil(t, err)
+
+	// when
+	delete(binaries, "static-tcpdump-arm64.gz")
+	secondPath, err := extractBinary(binaries, "arm64", cacheDir)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, firstPath, secondPath)
+}
+
+func TestExtractBinary_ChecksumMismatch(t *testing.T) {
+	// given
+	cacheDir, err := ioutil.TempDir("", "ksniff-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+	binaries := newBinariesFS(t, []byte("tcpdump"), sha256Hex([]byte("something else")))
+
+	// when
+	path, err := extractBinary(binaries, "arm64", cacheDir)
+
+	// then
+	assert.Equal(t, "", path)
+	assert.NotNil(t, err)
+}
+
+func TestExtractBinary_MissingArchitecture(t *testing.T) {
+	// given
+	binaries := newBinariesFS(t, []byte("tcpdump"), sha256Hex([]byte("tcpdump")))
+
+	// when
+	path, err := extractBinary(binaries, "amd64", os.TempDir())
+
+	// then
+	assert.Equal(t, "", path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// FileSha256 returns the hex encoded sha256 of the file at the given path
+func FileSha256(path string) (string, error) {
+	return fileChecksum(path, sha256.New())
+}
+
+// FileMd5 returns the hex encoded md5 of the file at the given path
+func FileMd5(path string) (string, error) {
+	return fileChecksum(path, md5.New())
+}
+
+func fileChecksum(path string, hash hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
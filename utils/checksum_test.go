@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileChecksums(t *testing.T) {
+	// given
+	file, err := ioutil.TempFile("", "checksum")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, _ = file.WriteString("ksniff")
+	_ = file.Close()
+
+	// when
+	sha256Sum, sha256Err := FileSha256(file.Name())
+	md5Sum, md5Err := FileMd5(file.Name())
+
+	// then
+	assert.Nil(t, sha256Err)
+	assert.Nil(t, md5Err)
+	assert.Equal(t, "05f6011df9fc928707d2ae7c7d6d2ddd5100195fd0baa90af9b00f4ec1935acc", sha256Sum)
+	assert.Equal(t, "3bf76dc8bfe6f24049d6c2b8ecef8e2f", md5Sum)
+}
+
+func TestFileChecksums_MissingFile(t *testing.T) {
+	_, err := FileSha256("/i-do-not-exist")
+	assert.NotNil(t, err)
+}
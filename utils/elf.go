@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"debug/elf"
+
+	"github.com/pkg/errors"
+)
+
+type elfTarget struct {
+	machine elf.Machine
+	// ppc64 and ppc64le share their machine type, only the byte order tells them apart
+	data elf.Data
+}
+
+// Kubernetes node architectures (GOARCH naming) to their ELF machine type and byte order
+var elfTargetByArchitecture = map[string]elfTarget{
+	"amd64":   {elf.EM_X86_64, elf.ELFDATA2LSB},
+	"arm64":   {elf.EM_AARCH64, elf.ELFDATA2LSB},
+	"arm":     {elf.EM_ARM, elf.ELFDATA2LSB},
+	"386":     {elf.EM_386, elf.ELFDATA2LSB},
+	"ppc64le": {elf.EM_PPC64, elf.ELFDATA2LSB},
+	"s390x":   {elf.EM_S390, elf.ELFDATA2MSB},
+	"riscv64": {elf.EM_RISCV, elf.ELFDATA2LSB},
+}
+
+// VerifyElfArchitecture returns an error when the binary at the given path isn't an ELF executable
+// built for the given architecture. Unknown architectures aren't verified.
+func VerifyElfArchitecture(path string, architecture string) error {
+	expected, ok := elfTargetByArchitecture[architecture]
+	if !ok {
+		return nil
+	}
+
+	binary, err := elf.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "'%s' isn't a valid ELF binary", path)
+	}
+	defer binary.Close()
+
+	if binary.Machine != expected.machine || binary.Data != expected.data {
+		return errors.Errorf("'%s' is built for '%s' '%s', expected '%s' '%s' (%s)", path, binary.Machine, binary.Data,
+			expected.machine, expected.data, architecture)
+	}
+
+	return nil
+}
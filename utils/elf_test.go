@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyElfArchitecture_Matching(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test binary is only an ELF on linux")
+	}
+
+	// given
+	path, err := os.Executable()
+	assert.Nil(t, err)
+
+	// when
+	err = VerifyElfArchitecture(path, runtime.GOARCH)
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestVerifyElfArchitecture_Mismatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test binary is only an ELF on linux")
+	}
+
+	// given
+	path, err := os.Executable()
+	assert.Nil(t, err)
+	otherArchitecture := "arm64"
+	if runtime.GOARCH == "arm64" {
+		otherArchitecture = "amd64"
+	}
+
+	// when
+	err = VerifyElfArchitecture(path, otherArchitecture)
+
+	// then
+	assert.NotNil(t, err)
+}
+
+// writeElfHeader writes a 64-bit ELF executable header, without any section or program
+func writeElfHeader(t *testing.T, data elf.Data, machine elf.Machine) string {
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if data == elf.ELFDATA2MSB {
+		byteOrder = binary.BigEndian
+	}
+
+	var header bytes.Buffer
+	header.Write([]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(data), byte(elf.EV_CURRENT)})
+	header.Write(make([]byte, elf.EI_NIDENT-header.Len()))
+	// Type, machine and version, then no entry point, program or section header
+	_ = binary.Write(&header, byteOrder, []uint16{uint16(elf.ET_EXEC), uint16(machine)})
+	_ = binary.Write(&header, byteOrder, []uint32{uint32(elf.EV_CURRENT)})
+	_ = binary.Write(&header, byteOrder, []uint64{0, 0, 0})
+	_ = binary.Write(&header, byteOrder, []uint32{0})
+	_ = binary.Write(&header, byteOrder, []uint16{64, 56, 0, 64, 0, 0})
+
+	file, err := ioutil.TempFile("", "elf")
+	assert.Nil(t, err)
+	_, _ = file.Write(header.Bytes())
+	_ = file.Close()
+
+	return file.Name()
+}
+
+func TestVerifyElfArchitecture_ByteOrder(t *testing.T) {
+	// given
+	bigEndian := writeElfHeader(t, elf.ELFDATA2MSB, elf.EM_PPC64)
+	defer os.Remove(bigEndian)
+	littleEndian := writeElfHeader(t, elf.ELFDATA2LSB, elf.EM_PPC64)
+	defer os.Remove(littleEndian)
+
+	// then
+	assert.NotNil(t, VerifyElfArchitecture(bigEndian, "ppc64le"), "ppc64 isn't ppc64le")
+	assert.Nil(t, VerifyElfArchitecture(littleEndian, "ppc64le"))
+}
+
+func TestVerifyElfArchitecture_NotElf(t *testing.T) {
+	// given
+	file, err := ioutil.TempFile("", "not-elf")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, _ = file.WriteString("#!/bin/sh\n")
+	_ = file.Close()
+
+	// when
+	err = VerifyElfArchitecture(file.Name(), "amd64")
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestVerifyElfArchitecture_UnknownArchitecture(t *testing.T) {
+	assert.Nil(t, VerifyElfArchitecture("/i-do-not-exist", "mips"))
+}
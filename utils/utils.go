@@ -3,10 +3,16 @@ package utils
 import (
 	"context"
 	"math/rand"
+	"strings"
 	"time"
 )
 
 func RunWhileFalse(fn func() bool, timeout time.Duration, delay time.Duration) bool {
+	return RunWhileFalseContext(context.Background(), fn, timeout, delay)
+}
+
+// RunWhileFalseContext is RunWhileFalse, also giving up once the given context is done
+func RunWhileFalseContext(parent context.Context, fn func() bool, timeout time.Duration, delay time.Duration) bool {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	if fn() {
@@ -14,10 +20,10 @@ func RunWhileFalse(fn func() bool, timeout time.Duration, delay time.Duration) b
 	}
 
 	// Timeout 0 is infinite timeout
-	if (timeout == 0) {
-		ctx, cancel = context.WithCancel(context.Background())
+	if timeout == 0 {
+		ctx, cancel = context.WithCancel(parent)
 	} else {
-		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		ctx, cancel = context.WithTimeout(parent, timeout)
 	}
 	delayTick := time.NewTicker(delay)
 
@@ -50,3 +56,9 @@ func GenerateRandomString(length int) string {
 
 	return string(b)
 }
+
+// ShellQuote wraps the given string in single quotes so it can be safely
+// embedded in a /bin/sh script.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
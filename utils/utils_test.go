@@ -71,4 +71,19 @@ func TestRuneWhileFalse_1SecTimeoutTrue(t *testing.T) {
 
 	// then
 	assert.True(t, result)
-}
\ No newline at end of file
+}
+
+func TestRunWhileFalseContext_Cancelled(t *testing.T) {
+	// given
+	f := func() bool {
+		return false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// when
+	result := RunWhileFalseContext(ctx, f, 0, 10*time.Millisecond)
+
+	// then
+	assert.False(t, result)
+}